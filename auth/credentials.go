@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Scheme string
+
+const (
+	SchemeApiKey Scheme = "ApiKey"
+	SchemeBearer Scheme = "Bearer"
+	SchemeBasic  Scheme = "Basic"
+)
+
+const DefaultRefreshInterval = 5 * time.Minute
+
+// CredentialProvider returns the value of the Authorization header to send
+// with each export request.
+type CredentialProvider interface {
+	AuthorizationHeader(ctx context.Context) (string, error)
+}
+
+type refreshingProvider struct {
+	scheme   Scheme
+	source   string
+	load     func() (string, error)
+	interval time.Duration
+
+	mu        sync.Mutex
+	value     string
+	fetchedAt time.Time
+}
+
+// NewEnvProvider reads the secret from the environment variable envVar. For
+// SchemeBasic the variable holds "user:password".
+func NewEnvProvider(scheme Scheme, envVar string) CredentialProvider {
+	return NewEnvProviderWithRefresh(scheme, envVar, DefaultRefreshInterval)
+}
+
+func NewEnvProviderWithRefresh(scheme Scheme, envVar string, interval time.Duration) CredentialProvider {
+	return &refreshingProvider{
+		scheme: scheme,
+		source: "env " + envVar,
+		load: func() (string, error) {
+			value, ok := os.LookupEnv(envVar)
+			if !ok {
+				return "", fmt.Errorf("environment variable %s is not set", envVar)
+			}
+			return value, nil
+		},
+		interval: interval,
+	}
+}
+
+// NewFileProvider reads the secret from a mounted file such as a Kubernetes
+// secret volume. For SchemeBasic the file holds "user:password".
+func NewFileProvider(scheme Scheme, path string) CredentialProvider {
+	return NewFileProviderWithRefresh(scheme, path, DefaultRefreshInterval)
+}
+
+func NewFileProviderWithRefresh(scheme Scheme, path string, interval time.Duration) CredentialProvider {
+	return &refreshingProvider{
+		scheme: scheme,
+		source: "file " + path,
+		load: func() (string, error) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return "", err
+			}
+			return string(data), nil
+		},
+		interval: interval,
+	}
+}
+
+func (p *refreshingProvider) AuthorizationHeader(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.value != "" && time.Since(p.fetchedAt) < p.interval {
+		return p.value, nil
+	}
+
+	secret, err := p.load()
+	if err == nil {
+		secret = strings.TrimSpace(secret)
+		if secret == "" {
+			err = errors.New("credential is empty")
+		}
+	}
+	if err != nil {
+		// Keep exporting with the last good credential until the source recovers.
+		if p.value != "" {
+			return p.value, nil
+		}
+		return "", fmt.Errorf("failed to load credential from %s: %w", p.source, err)
+	}
+
+	value, err := formatHeader(p.scheme, secret)
+	if err != nil {
+		return "", err
+	}
+	p.value = value
+	p.fetchedAt = time.Now()
+	return p.value, nil
+}
+
+func formatHeader(scheme Scheme, secret string) (string, error) {
+	switch scheme {
+	case SchemeApiKey, SchemeBearer:
+		return string(scheme) + " " + secret, nil
+	case SchemeBasic:
+		if !strings.Contains(secret, ":") {
+			return "", errors.New("basic credential must be in user:password form")
+		}
+		return string(scheme) + " " + base64.StdEncoding.EncodeToString([]byte(secret)), nil
+	default:
+		return "", fmt.Errorf("unsupported auth scheme %q", scheme)
+	}
+}
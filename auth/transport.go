@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/credentials"
+)
+
+type perRPCCredentials struct {
+	provider CredentialProvider
+	insecure bool
+}
+
+// PerRPCCredentials adapts a CredentialProvider for gRPC exporters so the
+// Authorization header is resolved on every export call. The credentials
+// require TLS, so gRPC refuses to send them in plaintext, unless endpointURL
+// uses http://, which the OTLP exporters treat as an explicit request for an
+// insecure connection.
+func PerRPCCredentials(provider CredentialProvider, endpointURL string) credentials.PerRPCCredentials {
+	return perRPCCredentials{
+		provider: provider,
+		insecure: strings.HasPrefix(strings.ToLower(endpointURL), "http://"),
+	}
+}
+
+func (c perRPCCredentials) GetRequestMetadata(ctx context.Context, _ ...string) (map[string]string, error) {
+	value, err := c.provider.AuthorizationHeader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"authorization": value}, nil
+}
+
+func (c perRPCCredentials) RequireTransportSecurity() bool {
+	return !c.insecure
+}
+
+type roundTripper struct {
+	provider CredentialProvider
+	base     http.RoundTripper
+}
+
+// RoundTripper adapts a CredentialProvider for HTTP exporters. A nil base uses
+// http.DefaultTransport.
+func RoundTripper(provider CredentialProvider, base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &roundTripper{provider: provider, base: base}
+}
+
+func (t *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	value, err := t.provider.AuthorizationHeader(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", value)
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,276 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"net/netip"
+	"os"
+	"regexp"
+	"slices"
+	"time"
+
+	"observability/logs"
+	"observability/metrics"
+	"observability/middleware"
+	"observability/tracer"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric/exemplar"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.uber.org/zap/zapcore"
+)
+
+// LoggerBuilder returns an OtelLoggerBuilder configured from the logs section.
+// It fails on an unknown level or an invalid redaction pattern, so configs
+// that skipped Validate don't panic or silently log at the wrong level.
+func (c *Config) LoggerBuilder() (*logs.OtelLoggerBuilder, error) {
+	b := logs.NewOtelLoggerBuilder().
+		WithServiceName(c.Service.Name).
+		WithResource(c.NewResource())
+
+	if c.Logs.Level != "" {
+		level, err := zapcore.ParseLevel(c.Logs.Level)
+		if err != nil {
+			return nil, fmt.Errorf("invalid logs.level: %w", err)
+		}
+		b.WithLevel(level)
+	}
+
+	e := c.Logs.Exporter
+	if e.exporterType() == ExporterConsole {
+		b.WithConsoleExporter()
+	} else {
+		b.WithEndpointUrl(e.Endpoint)
+		if len(e.Headers) > 0 {
+			b.WithHeaders(e.Headers)
+		}
+		if e.Auth != nil {
+			b.WithCredentialProvider(e.Auth.Provider())
+		}
+	}
+
+	if m := c.Logs.Metrics; m != nil {
+		b.WithRecordMetrics(m.IncludeTemplate)
+	}
+	if c.Logs.SemconvStability != "" {
+		b.WithSemconvStability(logs.SemconvStability(c.Logs.SemconvStability))
+	}
+	for i, rule := range c.Logs.Redaction {
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid logs.redaction[%d].pattern: %w", i, err)
+		}
+		b.WithRedactionRules(logs.RedactionRule{
+			Pattern:     pattern,
+			Replacement: rule.Replacement,
+		})
+	}
+	return b, nil
+}
+
+// MiddlewareOptions returns the TraceMiddleware options from the middleware section.
+func (c *Config) MiddlewareOptions() []middleware.Option {
+	var opts []middleware.Option
+	if c.Middleware.RequestIDHeader != "" {
+		opts = append(opts, middleware.WithRequestIDHeader(c.Middleware.RequestIDHeader))
+	}
+	if len(c.Middleware.ExcludedPaths) > 0 {
+		opts = append(opts, middleware.WithExcludedPaths(c.Middleware.ExcludedPaths...))
+	}
+	if s := c.Traces.Sampling; s.ForceHeader != "" {
+		opts = append(opts, middleware.WithForceTraceHeader(s.ForceHeader, os.Getenv(s.ForceTokenEnv)))
+	}
+	if c.Middleware.RecoverPanics {
+		opts = append(opts, middleware.WithPanicRecovery())
+	}
+	if len(c.Middleware.TrustedProxies) > 0 {
+		var prefixes []netip.Prefix
+		for _, proxy := range c.Middleware.TrustedProxies {
+			// Invalid entries are reported by validate.
+			if prefix, err := parseTrustedProxy(proxy); err == nil {
+				prefixes = append(prefixes, prefix)
+			}
+		}
+		opts = append(opts, middleware.WithTrustedProxies(prefixes...))
+	}
+	if c.Middleware.TraceResponse {
+		opts = append(opts, middleware.WithTraceResponse())
+	}
+	if c.Middleware.TraceIDHeader != "" {
+		opts = append(opts, middleware.WithTraceIDHeader(c.Middleware.TraceIDHeader))
+	}
+	if c.Middleware.ServerTiming {
+		opts = append(opts, middleware.WithServerTiming())
+	}
+	return opts
+}
+
+// TracerBuilder returns a tracer.Builder configured from the traces section.
+func (c *Config) TracerBuilder() *tracer.Builder {
+	b := tracer.NewBuilder().
+		WithServiceName(c.Service.Name).
+		WithResource(c.NewResource())
+
+	if c.Traces.Protocol != "" {
+		b.WithProtocol(tracer.Protocol(c.Traces.Protocol))
+	}
+	e := c.Traces.Exporter
+	switch e.exporterType() {
+	case ExporterConsole:
+		b.WithConsoleExporter()
+	case ExporterFile:
+		b.WithFileExporter(e.Path)
+	default:
+		b.WithEndpointUrl(e.Endpoint)
+		if len(e.Headers) > 0 {
+			b.WithHeaders(e.Headers)
+		}
+		if e.Auth != nil {
+			b.WithCredentialProvider(e.Auth.Provider())
+		}
+	}
+
+	b.WithSampler(c.sampler())
+	if len(c.Traces.Propagators) > 0 {
+		b.WithPropagatorNames(c.Traces.Propagators...)
+	}
+	if t := c.Traces.TailSampling; t != nil {
+		b.WithTailSampling(t.config())
+	}
+	if l := c.Traces.SpanLimits; l != nil {
+		b.WithSpanLimits(sdktrace.SpanLimits{
+			AttributeCountLimit:         l.AttributeCount,
+			AttributeValueLengthLimit:   l.AttributeValueLength,
+			EventCountLimit:             l.EventCount,
+			LinkCountLimit:              l.LinkCount,
+			AttributePerEventCountLimit: l.AttributePerEventCount,
+			AttributePerLinkCountLimit:  l.AttributePerLinkCount,
+		})
+	}
+	return b
+}
+
+// MeterBuilder returns a metrics.Builder configured from the metrics section.
+// For the prometheus exporter the caller attaches a metrics.PrometheusExporter,
+// so it can mount the handler; observability.Setup does this.
+func (c *Config) MeterBuilder() *metrics.Builder {
+	b := metrics.NewBuilder().
+		WithServiceName(c.Service.Name).
+		WithResource(c.NewResource()).
+		WithExportInterval(time.Duration(c.Metrics.Interval))
+
+	if c.Metrics.Protocol != "" {
+		b.WithProtocol(metrics.Protocol(c.Metrics.Protocol))
+	}
+	if c.Metrics.Temporality != "" {
+		b.WithTemporality(metrics.Temporality(c.Metrics.Temporality))
+	}
+	switch c.Metrics.ExemplarFilter {
+	case ExemplarFilterTraceBased:
+		b.WithExemplarFilter(exemplar.TraceBasedFilter)
+	case ExemplarFilterAlwaysOn:
+		b.WithExemplarFilter(exemplar.AlwaysOnFilter)
+	case ExemplarFilterAlwaysOff:
+		b.WithExemplarFilter(exemplar.AlwaysOffFilter)
+	}
+	if r := c.Metrics.Runtime; r != nil {
+		b.WithRuntimeMetrics(time.Duration(r.Interval))
+	}
+
+	e := c.Metrics.Exporter
+	switch e.exporterType() {
+	case ExporterConsole:
+		b.WithConsoleExporter()
+	case ExporterFile:
+		b.WithFileExporter(e.Path)
+	case ExporterPrometheus:
+	default:
+		b.WithEndpointUrl(e.Endpoint)
+		if len(e.Headers) > 0 {
+			b.WithHeaders(e.Headers)
+		}
+		if e.Auth != nil {
+			b.WithCredentialProvider(e.Auth.Provider())
+		}
+	}
+	return b
+}
+
+// config maps the tail_sampling section to policies in a fixed order: errors,
+// latency, attributes by key, then the probabilistic fallback.
+func (t *TailSampling) config() tracer.TailSamplingConfig {
+	cfg := tracer.TailSamplingConfig{
+		DecisionWait:     time.Duration(t.DecisionWait),
+		RootWait:         time.Duration(t.RootWait),
+		MaxTraces:        t.MaxTraces,
+		MaxSpansPerTrace: t.MaxSpansPerTrace,
+		MaxDecisions:     t.MaxDecisions,
+	}
+	if t.KeepErrors {
+		cfg.Policies = append(cfg.Policies, tracer.ErrorPolicy())
+	}
+	if t.LatencyThreshold > 0 {
+		cfg.Policies = append(cfg.Policies, tracer.LatencyPolicy(time.Duration(t.LatencyThreshold)))
+	}
+	// Sorted, so the first matching policy reported in the decisions metric
+	// doesn't change from run to run.
+	for _, key := range slices.Sorted(maps.Keys(t.Attributes)) {
+		cfg.Policies = append(cfg.Policies, tracer.AttributePolicy(attribute.Key(key), t.Attributes[key]...))
+	}
+	if t.Ratio > 0 {
+		cfg.Policies = append(cfg.Policies, tracer.ProbabilisticPolicy(t.Ratio))
+	}
+	return cfg
+}
+
+// sampler composes, from outermost to innermost: forced sampling, per-route
+// rules, then the parent-based ratio and rate limit for new traces.
+func (c *Config) sampler() sdktrace.Sampler {
+	s := c.Traces.Sampling
+
+	var root sdktrace.Sampler = sdktrace.AlwaysSample()
+	if s.Ratio != nil {
+		root = sdktrace.TraceIDRatioBased(*s.Ratio)
+	}
+	if s.RateLimit > 0 {
+		root = tracer.NewRateLimitedSampler(root, s.RateLimit)
+	}
+	sampler := sdktrace.ParentBased(root)
+
+	if len(s.Rules) > 0 {
+		rules := make([]tracer.RouteRule, len(s.Rules))
+		for i, rule := range s.Rules {
+			rules[i] = tracer.RouteRule{Path: rule.Path, Sample: rule.Sample}
+		}
+		sampler = tracer.NewRouteSampler(sampler, rules...)
+	}
+	if s.ForceHeader != "" {
+		sampler = tracer.NewForceSampler(sampler)
+	}
+	return sampler
+}
+
+// NewResource returns the service resource shared by the log, trace and metric
+// providers.
+func (c *Config) NewResource() *resource.Resource {
+	return resource.NewSchemaless(append([]attribute.KeyValue{
+		semconv.ServiceName(c.Service.Name),
+		semconv.TelemetrySDKLanguageGo,
+	}, c.resourceAttributes()...)...)
+}
+
+func (c *Config) resourceAttributes() []attribute.KeyValue {
+	var attrs []attribute.KeyValue
+	if c.Service.Version != "" {
+		attrs = append(attrs, semconv.ServiceVersion(c.Service.Version))
+	}
+	if c.Service.Environment != "" {
+		attrs = append(attrs, semconv.DeploymentEnvironment(c.Service.Environment))
+	}
+	for key, value := range c.Resource.Attributes {
+		attrs = append(attrs, attribute.String(key, value))
+	}
+	return attrs
+}
@@ -0,0 +1,481 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"observability/auth"
+	"observability/logs"
+	"observability/metrics"
+	"observability/tracer"
+	"observability/validation"
+
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	ExporterOTLP    = "otlp"
+	ExporterConsole = "console"
+	ExporterFile    = "file"
+	// ExporterPrometheus serves metrics for scraping instead of pushing them.
+	ExporterPrometheus = "prometheus"
+)
+
+// Exemplar filters, matching the values of OTEL_METRICS_EXEMPLAR_FILTER.
+const (
+	ExemplarFilterTraceBased = "trace_based"
+	ExemplarFilterAlwaysOn   = "always_on"
+	ExemplarFilterAlwaysOff  = "always_off"
+)
+
+type Config struct {
+	Service    Service    `json:"service" yaml:"service"`
+	Resource   Resource   `json:"resource" yaml:"resource"`
+	Logs       Logs       `json:"logs" yaml:"logs"`
+	Traces     Traces     `json:"traces" yaml:"traces"`
+	Metrics    Metrics    `json:"metrics" yaml:"metrics"`
+	Middleware Middleware `json:"middleware" yaml:"middleware"`
+	// ShutdownTimeout bounds Shutdown when its context has no deadline.
+	ShutdownTimeout Duration `json:"shutdown_timeout" yaml:"shutdown_timeout"`
+}
+
+type Service struct {
+	Name        string `json:"name" yaml:"name"`
+	Version     string `json:"version" yaml:"version"`
+	Environment string `json:"environment" yaml:"environment"`
+}
+
+type Resource struct {
+	Attributes map[string]string `json:"attributes" yaml:"attributes"`
+}
+
+type Exporter struct {
+	Type     string            `json:"type" yaml:"type"`
+	Endpoint string            `json:"endpoint" yaml:"endpoint"`
+	Headers  map[string]string `json:"headers" yaml:"headers"`
+	Auth     *Auth             `json:"auth" yaml:"auth"`
+	// Path is the output file of the file exporter.
+	Path string `json:"path" yaml:"path"`
+}
+
+type Auth struct {
+	Scheme string `json:"scheme" yaml:"scheme"`
+	Env    string `json:"env" yaml:"env"`
+	File   string `json:"file" yaml:"file"`
+}
+
+// Logs are always exported with OTLP over gRPC; unlike traces and metrics
+// there is no protocol option, as only the gRPC log exporter is wired up.
+type Logs struct {
+	Level     string          `json:"level" yaml:"level"`
+	Exporter  Exporter        `json:"exporter" yaml:"exporter"`
+	Redaction []RedactionRule `json:"redaction" yaml:"redaction"`
+	// Metrics enables the log.records counter when set.
+	Metrics *LogMetrics `json:"metrics" yaml:"metrics"`
+	// SemconvStability is legacy, stable or dup and selects the HTTP attribute
+	// keys of access logs. Empty defers to OTEL_SEMCONV_STABILITY_OPT_IN.
+	SemconvStability string `json:"semconv_stability" yaml:"semconv_stability"`
+}
+
+type LogMetrics struct {
+	// IncludeTemplate adds the format template of the *f methods as a label.
+	IncludeTemplate bool `json:"include_template" yaml:"include_template"`
+}
+
+type RedactionRule struct {
+	Pattern     string `json:"pattern" yaml:"pattern"`
+	Replacement string `json:"replacement" yaml:"replacement"`
+}
+
+type Traces struct {
+	Exporter Exporter `json:"exporter" yaml:"exporter"`
+	// Protocol is "grpc" or "http/protobuf" (the default).
+	Protocol     string        `json:"protocol" yaml:"protocol"`
+	Sampling     Sampling      `json:"sampling" yaml:"sampling"`
+	TailSampling *TailSampling `json:"tail_sampling" yaml:"tail_sampling"`
+	// Propagators uses OTEL_PROPAGATORS names; empty falls back to that variable.
+	Propagators []string    `json:"propagators" yaml:"propagators"`
+	SpanLimits  *SpanLimits `json:"span_limits" yaml:"span_limits"`
+}
+
+// SpanLimits mirrors sdktrace.SpanLimits. Zero keeps the SDK default and -1
+// means unlimited.
+type SpanLimits struct {
+	AttributeCount         int `json:"attribute_count" yaml:"attribute_count"`
+	AttributeValueLength   int `json:"attribute_value_length" yaml:"attribute_value_length"`
+	EventCount             int `json:"event_count" yaml:"event_count"`
+	LinkCount              int `json:"link_count" yaml:"link_count"`
+	AttributePerEventCount int `json:"attribute_per_event_count" yaml:"attribute_per_event_count"`
+	AttributePerLinkCount  int `json:"attribute_per_link_count" yaml:"attribute_per_link_count"`
+}
+
+type TailSampling struct {
+	DecisionWait     Duration            `json:"decision_wait" yaml:"decision_wait"`
+	RootWait         Duration            `json:"root_wait" yaml:"root_wait"`
+	MaxTraces        int                 `json:"max_traces" yaml:"max_traces"`
+	MaxSpansPerTrace int                 `json:"max_spans_per_trace" yaml:"max_spans_per_trace"`
+	MaxDecisions     int                 `json:"max_decisions" yaml:"max_decisions"`
+	KeepErrors       bool                `json:"keep_errors" yaml:"keep_errors"`
+	LatencyThreshold Duration            `json:"latency_threshold" yaml:"latency_threshold"`
+	Attributes       map[string][]string `json:"attributes" yaml:"attributes"`
+	// Ratio is the fraction of the remaining traces kept.
+	Ratio float64 `json:"ratio" yaml:"ratio"`
+}
+
+// Duration accepts Go duration strings such as "500ms" or "1m".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// UnmarshalYAML reports a bad value as a type error with its line, which
+// Load turns into the config path.
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode && d.UnmarshalText([]byte(node.Value)) == nil {
+		return nil
+	}
+	return &yaml.TypeError{Errors: []string{
+		fmt.Sprintf("line %d: invalid duration %q, expected a value such as \"500ms\" or \"1m\"", node.Line, node.Value),
+	}}
+}
+
+// UnmarshalJSON reports a bad value as a type error, which encoding/json
+// annotates with the field path.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if json.Unmarshal(data, &s) == nil && d.UnmarshalText([]byte(s)) == nil {
+		return nil
+	}
+	return &json.UnmarshalTypeError{Value: "duration " + string(data), Type: reflect.TypeFor[Duration]()}
+}
+
+type Sampling struct {
+	// Ratio is the parent-based probability of sampling a new trace. Nil
+	// samples everything.
+	Ratio *float64 `json:"ratio" yaml:"ratio"`
+	// RateLimit caps new traces per second. Zero means no cap.
+	RateLimit float64        `json:"rate_limit" yaml:"rate_limit"`
+	Rules     []SamplingRule `json:"rules" yaml:"rules"`
+	// ForceHeader forces sampling of requests sending the secret held in the
+	// ForceTokenEnv environment variable. Off unless both are set.
+	ForceHeader   string `json:"force_header" yaml:"force_header"`
+	ForceTokenEnv string `json:"force_token_env" yaml:"force_token_env"`
+}
+
+type SamplingRule struct {
+	Path   string `json:"path" yaml:"path"`
+	Sample bool   `json:"sample" yaml:"sample"`
+}
+
+type Metrics struct {
+	Exporter Exporter `json:"exporter" yaml:"exporter"`
+	// Protocol is "grpc" or "http/protobuf" (the default).
+	Protocol string `json:"protocol" yaml:"protocol"`
+	// Temporality is "cumulative" (the default), "delta" or "lowmemory".
+	Temporality string `json:"temporality" yaml:"temporality"`
+	// Interval between exports. Zero uses the SDK default of one minute.
+	Interval Duration `json:"interval" yaml:"interval"`
+	// ExemplarFilter is "trace_based", "always_on" or "always_off". Empty
+	// defers to OTEL_METRICS_EXEMPLAR_FILTER, then trace_based.
+	ExemplarFilter string `json:"exemplar_filter" yaml:"exemplar_filter"`
+	// Runtime enables Go runtime and process metrics when set.
+	Runtime *RuntimeMetrics `json:"runtime" yaml:"runtime"`
+}
+
+type RuntimeMetrics struct {
+	// Interval between reads of the runtime statistics. Zero uses 15s.
+	Interval Duration `json:"interval" yaml:"interval"`
+}
+
+type Middleware struct {
+	RequestIDHeader string   `json:"request_id_header" yaml:"request_id_header"`
+	ExcludedPaths   []string `json:"excluded_paths" yaml:"excluded_paths"`
+	// RecoverPanics turns handler panics into traced 500 responses.
+	RecoverPanics bool `json:"recover_panics" yaml:"recover_panics"`
+	// TrustedProxies lists the CIDRs or addresses of proxies whose
+	// Forwarded, X-Forwarded-For and X-Real-IP headers are trusted.
+	TrustedProxies []string `json:"trusted_proxies" yaml:"trusted_proxies"`
+	// TraceResponse and TraceIDHeader expose the trace to clients, so they
+	// can report it along with an error.
+	TraceResponse bool   `json:"trace_response" yaml:"trace_response"`
+	TraceIDHeader string `json:"trace_id_header" yaml:"trace_id_header"`
+	// ServerTiming writes a Server-Timing header with the request phases.
+	ServerTiming bool `json:"server_timing" yaml:"server_timing"`
+}
+
+// Load reads a YAML or JSON config file, chosen by extension, and validates
+// it. Unknown keys are rejected. Validation problems are returned as
+// validation.Errors keyed by the offending config path.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config %s: %w", path, err)
+	}
+
+	var cfg Config
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&cfg)
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(&cfg)
+	default:
+		return nil, fmt.Errorf("unsupported config format %q, expected .yaml, .yml or .json", filepath.Ext(path))
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		if errs := decodeErrors(data, err); errs != nil {
+			err = errs
+		}
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+func (c *Config) Validate() error {
+	var errs validation.Errors
+
+	if c.Service.Name == "" {
+		errs.Addf("service.name", "is required")
+	}
+	for key := range c.Resource.Attributes {
+		if key == "" {
+			errs.Addf("resource.attributes", "attribute keys must not be empty")
+		}
+	}
+
+	if c.Logs.Level != "" {
+		if _, err := zapcore.ParseLevel(c.Logs.Level); err != nil {
+			errs.Addf("logs.level", "unknown level %q", c.Logs.Level)
+		}
+	}
+	validateExporter(&errs, "logs.exporter", c.Logs.Exporter)
+	switch c.Logs.Exporter.Type {
+	case ExporterFile, ExporterPrometheus:
+		errs.Addf("logs.exporter.type", "the %s exporter is not supported for logs", c.Logs.Exporter.Type)
+	}
+	switch logs.SemconvStability(c.Logs.SemconvStability) {
+	case "", logs.SemconvLegacy, logs.SemconvStable, logs.SemconvDup:
+	default:
+		errs.Addf("logs.semconv_stability", "unknown mode %q, expected %s, %s or %s", c.Logs.SemconvStability,
+			logs.SemconvLegacy, logs.SemconvStable, logs.SemconvDup)
+	}
+	for i, rule := range c.Logs.Redaction {
+		field := fmt.Sprintf("logs.redaction[%d].pattern", i)
+		if rule.Pattern == "" {
+			errs.Addf(field, "is required")
+		} else if _, err := regexp.Compile(rule.Pattern); err != nil {
+			errs.Addf(field, "invalid regular expression: %v", err)
+		}
+	}
+
+	validateExporter(&errs, "traces.exporter", c.Traces.Exporter)
+	if c.Traces.Exporter.Type == ExporterPrometheus {
+		errs.Addf("traces.exporter.type", "the %s exporter is only supported for metrics", ExporterPrometheus)
+	}
+	if r := c.Traces.Sampling.Ratio; r != nil && (*r < 0 || *r > 1) {
+		errs.Addf("traces.sampling.ratio", "must be between 0 and 1, got %v", *r)
+	}
+	if c.Traces.Sampling.RateLimit < 0 {
+		errs.Addf("traces.sampling.rate_limit", "must not be negative, got %v", c.Traces.Sampling.RateLimit)
+	}
+	if len(c.Traces.Propagators) > 0 {
+		if _, err := tracer.Propagators(c.Traces.Propagators...); err != nil {
+			errs.Addf("traces.propagators", "%v", err)
+		}
+	}
+	if l := c.Traces.SpanLimits; l != nil {
+		for _, f := range []struct {
+			key   string
+			value int
+		}{
+			{"attribute_count", l.AttributeCount},
+			{"attribute_value_length", l.AttributeValueLength},
+			{"event_count", l.EventCount},
+			{"link_count", l.LinkCount},
+			{"attribute_per_event_count", l.AttributePerEventCount},
+			{"attribute_per_link_count", l.AttributePerLinkCount},
+		} {
+			if f.value < -1 {
+				errs.Addf("traces.span_limits."+f.key, "must be -1 (unlimited) or greater, got %d", f.value)
+			}
+		}
+	}
+	if t := c.Traces.TailSampling; t != nil {
+		if t.DecisionWait < 0 {
+			errs.Addf("traces.tail_sampling.decision_wait", "must not be negative")
+		}
+		if t.RootWait < 0 {
+			errs.Addf("traces.tail_sampling.root_wait", "must not be negative")
+		}
+		if t.MaxTraces < 0 {
+			errs.Addf("traces.tail_sampling.max_traces", "must not be negative")
+		}
+		if t.MaxSpansPerTrace < 0 {
+			errs.Addf("traces.tail_sampling.max_spans_per_trace", "must not be negative")
+		}
+		if t.MaxDecisions < 0 {
+			errs.Addf("traces.tail_sampling.max_decisions", "must not be negative")
+		}
+		if t.Ratio < 0 || t.Ratio > 1 {
+			errs.Addf("traces.tail_sampling.ratio", "must be between 0 and 1, got %v", t.Ratio)
+		}
+		if !t.KeepErrors && t.LatencyThreshold <= 0 && len(t.Attributes) == 0 && t.Ratio == 0 {
+			errs.Addf("traces.tail_sampling", "no policy configured, every trace would be dropped")
+		}
+	}
+	for i, rule := range c.Traces.Sampling.Rules {
+		if !strings.HasPrefix(rule.Path, "/") {
+			errs.Addf(fmt.Sprintf("traces.sampling.rules[%d].path", i), "path %q must start with /", rule.Path)
+		}
+	}
+	if c.Traces.Sampling.ForceHeader != "" && c.Traces.Sampling.ForceTokenEnv == "" {
+		errs.Addf("traces.sampling.force_token_env", "is required with force_header")
+	}
+
+	switch tracer.Protocol(c.Traces.Protocol) {
+	case "", tracer.ProtocolGRPC, tracer.ProtocolHTTP:
+	default:
+		errs.Addf("traces.protocol", "unknown protocol %q, expected %s or %s", c.Traces.Protocol, tracer.ProtocolGRPC, tracer.ProtocolHTTP)
+	}
+
+	validateExporter(&errs, "metrics.exporter", c.Metrics.Exporter)
+	switch metrics.Protocol(c.Metrics.Protocol) {
+	case "", metrics.ProtocolGRPC, metrics.ProtocolHTTP:
+	default:
+		errs.Addf("metrics.protocol", "unknown protocol %q, expected %s or %s", c.Metrics.Protocol, metrics.ProtocolGRPC, metrics.ProtocolHTTP)
+	}
+	switch metrics.Temporality(c.Metrics.Temporality) {
+	case "", metrics.TemporalityCumulative, metrics.TemporalityDelta, metrics.TemporalityLowMemory:
+	default:
+		errs.Addf("metrics.temporality", "unknown temporality %q, expected %s, %s or %s", c.Metrics.Temporality,
+			metrics.TemporalityCumulative, metrics.TemporalityDelta, metrics.TemporalityLowMemory)
+	}
+	if c.Metrics.Interval < 0 {
+		errs.Addf("metrics.interval", "must not be negative")
+	}
+	switch c.Metrics.ExemplarFilter {
+	case "", ExemplarFilterTraceBased, ExemplarFilterAlwaysOn, ExemplarFilterAlwaysOff:
+	default:
+		errs.Addf("metrics.exemplar_filter", "unknown filter %q, expected %s, %s or %s", c.Metrics.ExemplarFilter,
+			ExemplarFilterTraceBased, ExemplarFilterAlwaysOn, ExemplarFilterAlwaysOff)
+	}
+	if r := c.Metrics.Runtime; r != nil && r.Interval < 0 {
+		errs.Addf("metrics.runtime.interval", "must not be negative")
+	}
+	if c.ShutdownTimeout < 0 {
+		errs.Addf("shutdown_timeout", "must not be negative")
+	}
+
+	for i, path := range c.Middleware.ExcludedPaths {
+		if !strings.HasPrefix(path, "/") {
+			errs.Addf(fmt.Sprintf("middleware.excluded_paths[%d]", i), "path %q must start with /", path)
+		}
+	}
+	for i, proxy := range c.Middleware.TrustedProxies {
+		if _, err := parseTrustedProxy(proxy); err != nil {
+			errs.Addf(fmt.Sprintf("middleware.trusted_proxies[%d]", i), "%q is not a CIDR or IP address", proxy)
+		}
+	}
+
+	return errs.Err()
+}
+
+func validateExporter(errs *validation.Errors, field string, e Exporter) {
+	switch e.exporterType() {
+	case ExporterConsole:
+		if e.Endpoint != "" {
+			errs.Addf(field+".endpoint", "must be empty for the %s exporter", ExporterConsole)
+		}
+	case ExporterFile:
+		if e.Path == "" {
+			errs.Addf(field+".path", "is required for the %s exporter", ExporterFile)
+		}
+		if e.Endpoint != "" {
+			errs.Addf(field+".endpoint", "must be empty for the %s exporter", ExporterFile)
+		}
+	case ExporterPrometheus:
+		if e.Endpoint != "" || len(e.Headers) > 0 || e.Auth != nil {
+			errs.Addf(field, "endpoint, headers and auth must be empty for the %s exporter", ExporterPrometheus)
+		}
+	case ExporterOTLP:
+		if e.Endpoint == "" {
+			errs.Addf(field+".endpoint", "is required for the %s exporter", ExporterOTLP)
+		} else if err := validation.ValidateEndpoint(e.Endpoint); err != nil {
+			errs.Addf(field+".endpoint", "%v", err)
+		}
+	default:
+		errs.Addf(field+".type", "unknown exporter %q, expected %s, %s, %s or %s", e.Type, ExporterOTLP, ExporterConsole, ExporterFile, ExporterPrometheus)
+	}
+
+	if e.Auth != nil {
+		switch auth.Scheme(e.Auth.Scheme) {
+		case auth.SchemeApiKey, auth.SchemeBearer, auth.SchemeBasic:
+		default:
+			errs.Addf(field+".auth.scheme", "unknown scheme %q, expected ApiKey, Bearer or Basic", e.Auth.Scheme)
+		}
+		if (e.Auth.Env == "") == (e.Auth.File == "") {
+			errs.Addf(field+".auth", "exactly one of env or file must be set")
+		}
+		for key := range e.Headers {
+			if strings.EqualFold(key, "Authorization") {
+				errs.Addf(field+".headers", "Authorization header conflicts with %s.auth", field)
+			}
+		}
+	}
+}
+
+// exporterType defaults to OTLP when an endpoint is given and to the console
+// exporter otherwise.
+func (e Exporter) exporterType() string {
+	if e.Type != "" {
+		return e.Type
+	}
+	if e.Endpoint != "" {
+		return ExporterOTLP
+	}
+	return ExporterConsole
+}
+
+func (a *Auth) Provider() auth.CredentialProvider {
+	if a.File != "" {
+		return auth.NewFileProvider(auth.Scheme(a.Scheme), a.File)
+	}
+	return auth.NewEnvProvider(auth.Scheme(a.Scheme), a.Env)
+}
+
+// parseTrustedProxy accepts a CIDR or a single address.
+func parseTrustedProxy(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		return prefix.Masked(), err
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
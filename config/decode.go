@@ -0,0 +1,88 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"observability/validation"
+
+	"gopkg.in/yaml.v3"
+)
+
+// decodeErrors turns type errors from decoding data into validation.Errors
+// keyed by config path, like those of Validate. It returns nil for other
+// errors, such as syntax errors, which already name their position.
+func decodeErrors(data []byte, err error) validation.Errors {
+	var errs validation.Errors
+
+	var jsonErr *json.UnmarshalTypeError
+	if errors.As(err, &jsonErr) {
+		if jsonErr.Field != "" {
+			errs.Addf(jsonErr.Field, "cannot use %s as %s", jsonErr.Value, jsonErr.Type)
+			return errs
+		}
+		// encoding/json doesn't add the path to errors of UnmarshalJSON
+		// methods. JSON is also YAML, so decode it again for path and line.
+		var cfg Config
+		err = yaml.Unmarshal(data, &cfg)
+	}
+
+	var yamlErr *yaml.TypeError
+	if !errors.As(err, &yamlErr) {
+		return nil
+	}
+	paths := yamlPaths(data)
+	for _, msg := range yamlErr.Errors {
+		// yaml.v3 prefixes each message with "line N: ".
+		var field string
+		if rest, ok := strings.CutPrefix(msg, "line "); ok {
+			if n, _, ok := strings.Cut(rest, ":"); ok {
+				if line, err := strconv.Atoi(n); err == nil {
+					field = paths[line]
+				}
+			}
+		}
+		errs.Addf(field, "%s", msg)
+	}
+	return errs
+}
+
+// yamlPaths maps lines of data to the dotted config path of the innermost
+// mapping value on them, such as "metrics.interval", or else of the first
+// sequence item, such as "middleware.trusted_proxies[0]".
+func yamlPaths(data []byte) map[int]string {
+	paths := map[int]string{}
+	var root yaml.Node
+	if yaml.Unmarshal(data, &root) != nil || len(root.Content) == 0 {
+		return paths
+	}
+
+	var walk func(node *yaml.Node, path string)
+	walk = func(node *yaml.Node, path string) {
+		switch node.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				key := node.Content[i].Value
+				if path != "" {
+					key = path + "." + key
+				}
+				value := node.Content[i+1]
+				paths[value.Line] = key
+				walk(value, key)
+			}
+		case yaml.SequenceNode:
+			for i, item := range node.Content {
+				itemPath := fmt.Sprintf("%s[%d]", path, i)
+				if _, ok := paths[item.Line]; !ok {
+					paths[item.Line] = itemPath
+				}
+				walk(item, itemPath)
+			}
+		}
+	}
+	walk(root.Content[0], "")
+	return paths
+}
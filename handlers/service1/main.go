@@ -3,8 +3,17 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
-
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"observability"
+	"observability/auth"
+	"observability/config"
 	"observability/logs"
 	"observability/middleware"
 	"observability/tracer"
@@ -14,39 +23,85 @@ import (
 )
 
 var ELASTIC_APM_SERVICE_NAME = "test-service"
-var ELASTIC_APM_API_KEY = "RUU2ZmE1Z0JCMnI4REdVdi1zVDk6aS1sZlp0RVJhemJ4YU15djc0cmhGQQ=="
+var ELASTIC_APM_API_KEY_ENV = "ELASTIC_APM_API_KEY"
 var ELASTIC_APM_ENDPOINT = "https://my-observability-project-b29ff9.apm.us-central1.gcp.elastic.cloud:443"
 
 func main() {
-	l, err := logs.NewOtelLoggerBuilder().
-		WithEndpointUrl(ELASTIC_APM_ENDPOINT).
-		WithServiceName(ELASTIC_APM_SERVICE_NAME).
-		WithAuthHeader(ELASTIC_APM_API_KEY).
-		Build(context.Background())
+	exporter := config.Exporter{
+		Endpoint: ELASTIC_APM_ENDPOINT,
+		Auth:     &config.Auth{Scheme: string(auth.SchemeApiKey), Env: ELASTIC_APM_API_KEY_ENV},
+	}
+	telemetry, err := observability.Setup(context.Background(), &config.Config{
+		Service: config.Service{Name: ELASTIC_APM_SERVICE_NAME, Environment: "TEST"},
+		Logs:    config.Logs{Exporter: exporter, Metrics: &config.LogMetrics{}},
+		Traces: config.Traces{
+			Exporter: exporter,
+			Sampling: config.Sampling{
+				Rules: []config.SamplingRule{
+					{Path: "/favicon.ico", Sample: false},
+					{Path: "/healthz", Sample: false},
+					{Path: "/test-error", Sample: true},
+				},
+				ForceHeader:   tracer.DefaultForceTraceHeader,
+				ForceTokenEnv: "FORCE_TRACE_TOKEN",
+			},
+			SpanLimits: &config.SpanLimits{AttributeValueLength: 4096},
+		},
+		Metrics: config.Metrics{Exporter: exporter, Runtime: &config.RuntimeMetrics{}},
+		Middleware: config.Middleware{
+			RecoverPanics: true,
+			TraceResponse: true,
+			TraceIDHeader: middleware.DefaultTraceIDHeader,
+			ServerTiming:  true,
+		},
+	})
 	if err != nil {
 		panic(err)
 	}
-
-	cleanup := tracer.InitTracer()
-	defer cleanup()
+	l := telemetry.Logger
 
 	mux := http.NewServeMux()
 	mux.Handle("/test", TestHandler(l))
 	mux.Handle("/test-error", TestErrorHandler(l))
 	mux.Handle("/greet", GreetHandler(l))
-	http.HandleFunc("/favicon.ico", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/favicon.ico", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusNoContent)
 	})
+	if telemetry.MetricsHandler != nil {
+		mux.Handle("/metrics", telemetry.MetricsHandler)
+	}
 
-	wrapped := middleware.TraceMiddleware(ELASTIC_APM_SERVICE_NAME, l)(mux)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	l.Info(nil, "Starting server on :8080")
-	http.ListenAndServe(":8080", wrapped)
+	server := &http.Server{Addr: ":8080", Handler: telemetry.Middleware(mux)}
+	go func() {
+		l.Info(nil, "Starting server on :8080")
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			l.Errorf(nil, "Server failed: %v", err)
+		}
+		stop()
+	}()
+	<-ctx.Done()
+
+	// Let in-flight requests finish, so their spans and logs are flushed too.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		l.Errorf(nil, "Server shutdown failed: %v", err)
+	}
+	// Setup's shutdown timeout applies, independently of the server's.
+	if err := telemetry.Shutdown(context.Background()); err != nil {
+		fmt.Fprintf(os.Stderr, "telemetry shutdown failed: %v\n", err)
+	}
 }
 
+// outboundClient forwards the request ID of the incoming request.
+var outboundClient = &http.Client{Transport: middleware.RequestIDRoundTripper(nil)}
+
 func TestHandler(l logs.OtelLogging) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx := r.Context()
 
 		tracer := otel.Tracer("test-service")
 		ctx, span := tracer.Start(ctx, "client-request")
@@ -63,7 +118,9 @@ func TestHandler(l logs.OtelLogging) http.HandlerFunc {
 
 		otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
 
-		resp, err := http.DefaultClient.Do(req)
+		callStart := time.Now()
+		resp, err := outboundClient.Do(req)
+		middleware.AddServerTiming(ctx, "test-error", time.Since(callStart))
 		if err != nil {
 			l.Error(span, "Outbound request failed", map[string]interface{}{
 				"error": err.Error(),
@@ -84,8 +141,8 @@ func TestHandler(l logs.OtelLogging) http.HandlerFunc {
 
 func TestErrorHandler(l logs.OtelLogging) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Propagate context from incoming request
-		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		// The middleware has already extracted the incoming trace context.
+		ctx := r.Context()
 		tracer := otel.Tracer("test-service")
 
 		ctx, span := tracer.Start(ctx, "Handle /test-error")
@@ -219,7 +276,7 @@ type Response struct {
 
 func GreetHandler(l logs.OtelLogging) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx := r.Context()
 		tracer := otel.Tracer("test-service")
 		_, span := tracer.Start(ctx, "Handle /greet")
 		defer span.End()
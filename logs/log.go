@@ -3,12 +3,14 @@ package logs
 import (
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"time"
 
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 type RequestMeta struct {
@@ -20,6 +22,21 @@ type RequestMeta struct {
 	RemoteIP  string
 	Query     string
 	RequestID string
+
+	// Duration is the time from the start of the request until the response
+	// was logged. Sizes are body bytes; zero when unknown.
+	Duration     time.Duration
+	RequestSize  int64
+	ResponseSize int64
+	Protocol     string
+	Scheme       string
+	Referer      string
+	ContentType  string
+
+	// ClientAddress is the originating client, which differs from the
+	// PeerAddress behind proxies. Neither includes a port.
+	ClientAddress string
+	PeerAddress   string
 }
 
 type OtelLogging interface {
@@ -43,11 +60,15 @@ type OtelLogging interface {
 }
 
 type otelLog struct {
-	logger *zap.Logger
+	logger     *zap.Logger
+	redact     redactor
+	records    *recordCounter
+	semconv    SemconvStability
+	requestIDs *RequestIDProcessor
 }
 
 func NewOtelLogging(zapLogger *zap.Logger) OtelLogging {
-	return &otelLog{logger: zapLogger}
+	return &otelLog{logger: zapLogger, semconv: semconvStabilityFromEnv()}
 }
 
 func (l *otelLog) logSpan(span trace.Span, level, message string) (string, string) {
@@ -57,7 +78,7 @@ func (l *otelLog) logSpan(span trace.Span, level, message string) (string, strin
 
 		span.SetAttributes(
 			attribute.String("log.level", level),
-			attribute.String("log.message", message),
+			attribute.String("log.message", l.redact.redact(message)),
 			attribute.String("trace_id", traceID),
 			attribute.String("span_id", spanID),
 		)
@@ -75,20 +96,24 @@ func (l *otelLog) LogJson(span trace.Span, label string, value interface{}) {
 	// Convert value to pretty JSON string
 	jsonBytes, err := json.MarshalIndent(value, "", "  ")
 	if err != nil {
+		l.records.add(span, zapcore.ErrorLevel, "")
 		l.logger.Error("Failed to marshal JSON",
 			zap.String("label", label),
 			zap.Error(err),
 			zap.String("trace_id", traceID),
 			zap.String("span_id", spanID),
+			l.requestIDs.field(span),
 		)
 		return
 	}
 	stringified := string(jsonBytes)
 
 	// Log everything as a string with type info
+	l.records.add(span, zapcore.InfoLevel, "")
 	l.logger.Info(fmt.Sprintf("%s : %s", label, stringified),
 		zap.String("trace_id", traceID),
 		zap.String("span_id", spanID),
+		l.requestIDs.field(span),
 	)
 
 }
@@ -98,69 +123,91 @@ func (l *otelLog) LogHttpResponse(span trace.Span, meta RequestMeta) {
 		return
 	}
 
-	spanAttrs := []attribute.KeyValue{
-		attribute.Int("http.status_code", meta.Status),
-	}
+	str := attribute.StringValue
+	a := newHTTPAttributes(l.semconv)
+
+	a.addLegacy("http.status_code", "http_status", attribute.IntValue(meta.Status))
+	a.addStable("http.response.status_code", attribute.IntValue(meta.Status))
 	if meta.Path != "" {
-		spanAttrs = append(spanAttrs, attribute.String("http.path", meta.Path))
+		a.addLegacy("http.path", "http_path", str(meta.Path))
+		a.addStable("url.path", str(meta.Path))
 	}
 	if meta.Domain != "" {
-		spanAttrs = append(spanAttrs, attribute.String("http.domain", meta.Domain))
+		a.addLegacy("http.domain", "http_domain", str(meta.Domain))
+		a.addStable("server.address", str(meta.Domain))
 	}
 	if meta.Agent != "" {
-		spanAttrs = append(spanAttrs, attribute.String("http.user_agent", meta.Agent))
+		a.addLegacy("http.user_agent", "user_agent", str(meta.Agent))
+		a.addStable("user_agent.original", str(meta.Agent))
 	}
 	if meta.Method != "" {
-		spanAttrs = append(spanAttrs, attribute.String("http.method", meta.Method))
+		a.addLegacy("http.method", "http_method", str(meta.Method))
+		a.addStable("http.request.method", str(meta.Method))
 	}
 	if meta.RemoteIP != "" {
-		spanAttrs = append(spanAttrs, attribute.String("http.remote_ip", meta.RemoteIP))
+		a.addLegacy("http.remote_ip", "remote_ip", str(meta.RemoteIP))
 	}
 	if meta.Query != "" {
-		spanAttrs = append(spanAttrs, attribute.String("http.query_params", meta.Query))
+		a.addLegacy("http.query_params", "query_params", str(meta.Query))
+		a.addStable("url.query", str(meta.Query))
 	}
-	if meta.RequestID != "" {
-		spanAttrs = append(spanAttrs, attribute.String("http.request_id", meta.RequestID))
+	if meta.ClientAddress != "" {
+		a.addLegacy("client.address", "client_address", str(meta.ClientAddress))
+		a.addStable("client.address", str(meta.ClientAddress))
 	}
-
-	span.SetAttributes(spanAttrs...)
-
-	traceID := span.SpanContext().TraceID().String()
-	spanID := span.SpanContext().SpanID().String()
-
-	logFields := []zap.Field{
-		zap.Int("http_status", meta.Status),
-		zap.String("trace_id", traceID),
-		zap.String("span_id", spanID),
+	if meta.PeerAddress != "" {
+		a.addLegacy("network.peer.address", "network_peer_address", str(meta.PeerAddress))
+		a.addStable("network.peer.address", str(meta.PeerAddress))
 	}
-	if meta.Path != "" {
-		logFields = append(logFields, zap.String("http_path", meta.Path))
+	if meta.Duration > 0 {
+		a.addAlways("http.duration_ms", "duration_ms", attribute.Float64Value(durationMillis(meta.Duration)))
 	}
-	if meta.Domain != "" {
-		logFields = append(logFields, zap.String("http_domain", meta.Domain))
+	if meta.RequestSize > 0 {
+		a.addLegacy("http.request_content_length", "request_size", attribute.Int64Value(meta.RequestSize))
+		a.addStable("http.request.body.size", attribute.Int64Value(meta.RequestSize))
 	}
-	if meta.Agent != "" {
-		logFields = append(logFields, zap.String("user_agent", meta.Agent))
+	if meta.ResponseSize > 0 {
+		a.addLegacy("http.response_content_length", "response_size", attribute.Int64Value(meta.ResponseSize))
+		a.addStable("http.response.body.size", attribute.Int64Value(meta.ResponseSize))
 	}
-	if meta.Method != "" {
-		logFields = append(logFields, zap.String("http_method", meta.Method))
+	if meta.Protocol != "" {
+		a.addLegacy("http.protocol", "protocol", str(meta.Protocol))
+		a.addStable("network.protocol.version", str(protocolVersion(meta.Protocol)))
 	}
-	if meta.RemoteIP != "" {
-		logFields = append(logFields, zap.String("remote_ip", meta.RemoteIP))
+	if meta.Scheme != "" {
+		a.addLegacy("http.scheme", "scheme", str(meta.Scheme))
+		a.addStable("url.scheme", str(meta.Scheme))
 	}
-	if meta.Query != "" {
-		logFields = append(logFields, zap.String("query_params", meta.Query))
+	if meta.Referer != "" {
+		a.addLegacy("http.referer", "referer", str(meta.Referer))
+		a.addStable("http.request.header.referer", attribute.StringSliceValue([]string{meta.Referer}))
+	}
+	if meta.ContentType != "" {
+		a.addLegacy("http.content_type", "content_type", str(meta.ContentType))
+		a.addStable("http.request.header.content-type", attribute.StringSliceValue([]string{meta.ContentType}))
 	}
 	if meta.RequestID != "" {
-		logFields = append(logFields, zap.String("request_id", meta.RequestID))
+		a.addAlways(string(RequestIDKey), "request_id", str(meta.RequestID))
+	}
+
+	span.SetAttributes(a.span...)
+
+	traceID := span.SpanContext().TraceID().String()
+	spanID := span.SpanContext().SpanID().String()
+
+	logFields := append(a.fields, zap.String("trace_id", traceID), zap.String("span_id", spanID))
+	if meta.RequestID == "" {
+		logFields = append(logFields, l.requestIDs.field(span))
 	}
 
 	log := l.logger.With(logFields...)
 
 	switch {
 	case meta.Status >= 500:
+		l.records.add(span, zapcore.ErrorLevel, "")
 		log.Error("Internal Server Error occurred", zap.Stack("stacktrace"))
 	case meta.Status >= 400:
+		l.records.add(span, zapcore.WarnLevel, "")
 		log.Warn("Client error response recorded")
 	case meta.Status >= 300:
 		log.Info("Redirection response recorded")
@@ -169,102 +216,194 @@ func (l *otelLog) LogHttpResponse(span trace.Span, meta RequestMeta) {
 	default:
 		log.Info("Unexpected status code recorded")
 	}
+	if meta.Status < 400 {
+		l.records.add(span, zapcore.InfoLevel, "")
+	}
+}
+
+// RequestMetaOption sets a measured or resolved value of a RequestMeta.
+type RequestMetaOption func(*RequestMeta)
+
+// WithRequestID sets the request ID, instead of reading X-Request-ID.
+func WithRequestID(id string) RequestMetaOption {
+	return func(m *RequestMeta) {
+		m.RequestID = id
+	}
+}
+
+// WithSizes sets the counted body sizes, instead of Content-Length.
+func WithSizes(request, response int64) RequestMetaOption {
+	return func(m *RequestMeta) {
+		m.RequestSize = max(request, 0)
+		m.ResponseSize = max(response, 0)
+	}
+}
+
+// WithAddresses sets the client and peer addresses resolved behind proxies.
+func WithAddresses(client, peer string) RequestMetaOption {
+	return func(m *RequestMeta) {
+		m.ClientAddress = client
+		m.PeerAddress = peer
+	}
 }
 
-func BuildRequestMeta(r *http.Request, status int, started time.Time) RequestMeta {
+// WithScheme sets the scheme the client used, when a proxy terminated TLS.
+func WithScheme(scheme string) RequestMetaOption {
+	return func(m *RequestMeta) {
+		m.Scheme = scheme
+	}
+}
+
+// BuildRequestMeta describes r for LogHttpResponse. Duration is measured from
+// started unless it is zero, and RequestSize is taken from Content-Length.
+// Forwarding headers aren't trusted, so ClientAddress is the peer and Scheme
+// that of the connection; opts override these with measured or resolved
+// values, as the middleware does.
+func BuildRequestMeta(r *http.Request, status int, started time.Time, opts ...RequestMetaOption) RequestMeta {
 	domain := r.URL.Hostname()
 	if domain == "" {
 		domain = r.Host
 	}
-	return RequestMeta{
-		Status:    status,
-		Path:      r.URL.Path,
-		Domain:    domain,
-		Agent:     r.UserAgent(),
-		Method:    r.Method,
-		RemoteIP:  r.RemoteAddr,
-		Query:     r.URL.RawQuery,
-		RequestID: r.Header.Get("X-Request-ID"),
+	peer := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(peer); err == nil {
+		peer = host
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	meta := RequestMeta{
+		Status:      status,
+		Path:        r.URL.Path,
+		Domain:      domain,
+		Agent:       r.UserAgent(),
+		Method:      r.Method,
+		RemoteIP:    r.RemoteAddr,
+		Query:       r.URL.RawQuery,
+		RequestID:   r.Header.Get("X-Request-ID"),
+		RequestSize: max(r.ContentLength, 0),
+		Protocol:    r.Proto,
+		Scheme:      scheme,
+		Referer:     r.Referer(),
+		ContentType: r.Header.Get("Content-Type"),
+
+		ClientAddress: peer,
+		PeerAddress:   peer,
+	}
+	if !started.IsZero() {
+		meta.Duration = time.Since(started)
+	}
+	for _, opt := range opts {
+		opt(&meta)
 	}
+	return meta
 }
+
+func durationMillis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
 func (l *otelLog) Debug(span trace.Span, args ...interface{}) {
 	msg := fmt.Sprint(args...)
 	traceID, spanID := l.logSpan(span, "DEBUG", msg)
-	l.logger.Debug(msg, zap.String("trace_id", traceID), zap.String("span_id", spanID))
+	l.records.add(span, zapcore.DebugLevel, "")
+	l.logger.Debug(msg, zap.String("trace_id", traceID), zap.String("span_id", spanID), l.requestIDs.field(span))
 }
 
 func (l *otelLog) Debugf(span trace.Span, template string, args ...interface{}) {
 	msg := fmt.Sprintf(template, args...)
 	traceID, spanID := l.logSpan(span, "DEBUG", msg)
+	l.records.add(span, zapcore.DebugLevel, template)
 	l.logger.Sugar().Debugf(template, args...)
-	l.logger.Debug("Formatted Debug", zap.String("trace_id", traceID), zap.String("span_id", spanID))
+	l.logger.Debug("Formatted Debug", zap.String("trace_id", traceID), zap.String("span_id", spanID), l.requestIDs.field(span))
 }
 
 func (l *otelLog) Info(span trace.Span, args ...interface{}) {
 	msg := fmt.Sprint(args...)
 	traceID, spanID := l.logSpan(span, "INFO", msg)
-	l.logger.Info(msg, zap.String("trace_id", traceID), zap.String("span_id", spanID))
+	l.records.add(span, zapcore.InfoLevel, "")
+	l.logger.Info(msg, zap.String("trace_id", traceID), zap.String("span_id", spanID), l.requestIDs.field(span))
 }
 
 func (l *otelLog) Infof(span trace.Span, template string, args ...interface{}) {
 	msg := fmt.Sprintf(template, args...)
 	traceID, spanID := l.logSpan(span, "INFO", msg)
+	l.records.add(span, zapcore.InfoLevel, template)
 	l.logger.Sugar().Infof(template, args...)
-	l.logger.Info("Formatted Info", zap.String("trace_id", traceID), zap.String("span_id", spanID))
+	l.logger.Info("Formatted Info", zap.String("trace_id", traceID), zap.String("span_id", spanID), l.requestIDs.field(span))
 }
 
 func (l *otelLog) Warn(span trace.Span, args ...interface{}) {
 	msg := fmt.Sprint(args...)
 	traceID, spanID := l.logSpan(span, "WARN", msg)
-	l.logger.Warn(msg, zap.String("trace_id", traceID), zap.String("span_id", spanID))
+	l.records.add(span, zapcore.WarnLevel, "")
+	l.logger.Warn(msg, zap.String("trace_id", traceID), zap.String("span_id", spanID), l.requestIDs.field(span))
 }
 
 func (l *otelLog) Warnf(span trace.Span, template string, args ...interface{}) {
 	msg := fmt.Sprintf(template, args...)
 	traceID, spanID := l.logSpan(span, "WARN", msg)
+	l.records.add(span, zapcore.WarnLevel, template)
 	l.logger.Sugar().Warnf(template, args...)
-	l.logger.Warn("Formatted Warn", zap.String("trace_id", traceID), zap.String("span_id", spanID))
+	l.logger.Warn("Formatted Warn", zap.String("trace_id", traceID), zap.String("span_id", spanID), l.requestIDs.field(span))
 }
 
 func (l *otelLog) Error(span trace.Span, args ...interface{}) {
 	msg := fmt.Sprint(args...)
 	traceID, spanID := l.logSpan(span, "ERROR", msg)
-	l.logger.Error(msg, zap.String("trace_id", traceID), zap.String("span_id", spanID), zap.Stack("stacktrace"))
+	l.records.add(span, zapcore.ErrorLevel, "")
+	l.logger.Error(msg, zap.String("trace_id", traceID), zap.String("span_id", spanID), l.requestIDs.field(span), zap.Stack("stacktrace"))
 }
 
 func (l *otelLog) Errorf(span trace.Span, template string, args ...interface{}) {
 	msg := fmt.Sprintf(template, args...)
 	traceID, spanID := l.logSpan(span, "ERROR", msg)
+	l.records.add(span, zapcore.ErrorLevel, template)
 	l.logger.Sugar().Errorf(template, args...)
-	l.logger.Error("Formatted Error", zap.String("trace_id", traceID), zap.String("span_id", spanID), zap.Stack("stacktrace"))
+	l.logger.Error("Formatted Error", zap.String("trace_id", traceID), zap.String("span_id", spanID), l.requestIDs.field(span), zap.Stack("stacktrace"))
+}
+
+// Errorw logs message with keysAndValues as structured fields, paired the way
+// zap's SugaredLogger pairs them. It adds no stacktrace of its own. It isn't
+// part of OtelLogging, so implementations outside this package keep working.
+func (l *otelLog) Errorw(span trace.Span, message string, keysAndValues ...interface{}) {
+	traceID, spanID := l.logSpan(span, "ERROR", message)
+	l.records.add(span, zapcore.ErrorLevel, "")
+	keysAndValues = append(keysAndValues, zap.String("trace_id", traceID), zap.String("span_id", spanID), l.requestIDs.field(span))
+	l.logger.Sugar().Errorw(message, keysAndValues...)
 }
 
 func (l *otelLog) DPanic(span trace.Span, args ...interface{}) {
 	msg := fmt.Sprint(args...)
 	traceID, spanID := l.logSpan(span, "DPANIC", msg)
-	l.logger.DPanic(msg, zap.String("trace_id", traceID), zap.String("span_id", spanID), zap.Stack("stacktrace"))
+	l.records.add(span, zapcore.DPanicLevel, "")
+	l.logger.DPanic(msg, zap.String("trace_id", traceID), zap.String("span_id", spanID), l.requestIDs.field(span), zap.Stack("stacktrace"))
 }
 
 func (l *otelLog) DPanicf(span trace.Span, template string, args ...interface{}) {
 	msg := fmt.Sprintf(template, args...)
 	traceID, spanID := l.logSpan(span, "DPANIC", msg)
+	l.records.add(span, zapcore.DPanicLevel, template)
 	l.logger.Sugar().DPanicf(template, args...)
-	l.logger.DPanic("Formatted DPanic", zap.String("trace_id", traceID), zap.String("span_id", spanID), zap.Stack("stacktrace"))
+	l.logger.DPanic("Formatted DPanic", zap.String("trace_id", traceID), zap.String("span_id", spanID), l.requestIDs.field(span), zap.Stack("stacktrace"))
 }
 
 func (l *otelLog) Panic(span trace.Span, args ...interface{}) {
 	msg := fmt.Sprint(args...)
 	traceID, spanID := l.logSpan(span, "PANIC", msg)
-	l.logger.Panic(msg, zap.String("trace_id", traceID), zap.String("span_id", spanID), zap.Stack("stacktrace"))
+	l.records.add(span, zapcore.PanicLevel, "")
+	l.logger.Panic(msg, zap.String("trace_id", traceID), zap.String("span_id", spanID), l.requestIDs.field(span), zap.Stack("stacktrace"))
 }
 
 func (l *otelLog) Panicf(span trace.Span, template string, args ...interface{}) {
 	msg := fmt.Sprintf(template, args...)
 	traceID, spanID := l.logSpan(span, "PANIC", msg)
+	l.records.add(span, zapcore.PanicLevel, template)
 	l.logger.Panic(
 		msg,
 		zap.String("trace_id", traceID),
 		zap.String("span_id", spanID),
+		l.requestIDs.field(span),
 		zap.Stack("stacktrace"),
 	)
 }
@@ -272,17 +411,20 @@ func (l *otelLog) Panicf(span trace.Span, template string, args ...interface{})
 func (l *otelLog) Fatal(span trace.Span, args ...interface{}) {
 	msg := fmt.Sprint(args...)
 	traceID, spanID := l.logSpan(span, "FATAL", msg)
-	l.logger.Fatal(msg, zap.String("trace_id", traceID), zap.String("span_id", spanID), zap.Stack("stacktrace"))
+	l.records.add(span, zapcore.FatalLevel, "")
+	l.logger.Fatal(msg, zap.String("trace_id", traceID), zap.String("span_id", spanID), l.requestIDs.field(span), zap.Stack("stacktrace"))
 }
 
 func (l *otelLog) Fatalf(span trace.Span, template string, args ...interface{}) {
 	msg := fmt.Sprintf(template, args...)
 	traceID, spanID := l.logSpan(span, "FATAL", msg)
+	l.records.add(span, zapcore.FatalLevel, template)
 
 	l.logger.Fatal(
 		msg,
 		zap.String("trace_id", traceID),
 		zap.String("span_id", spanID),
+		l.requestIDs.field(span),
 		zap.Stack("stacktrace"),
 	)
 }
@@ -290,5 +432,6 @@ func (l *otelLog) Fatalf(span trace.Span, template string, args ...interface{})
 func (l *otelLog) Logf(span trace.Span, template string, args ...interface{}) {
 	msg := fmt.Sprintf(template, args...)
 	traceID, spanID := l.logSpan(span, "LOG", msg)
-	l.logger.Info(msg, zap.String("trace_id", traceID), zap.String("span_id", spanID))
+	l.records.add(span, zapcore.InfoLevel, template)
+	l.logger.Info(msg, zap.String("trace_id", traceID), zap.String("span_id", spanID), l.requestIDs.field(span))
 }
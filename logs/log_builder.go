@@ -5,7 +5,11 @@ import (
 	"fmt"
 	"os"
 
+	"observability/auth"
+	"observability/validation"
+
 	"go.opentelemetry.io/contrib/bridges/otelzap"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
 	"go.opentelemetry.io/otel/exporters/stdout/stdoutlog"
 	"go.opentelemetry.io/otel/log/global"
@@ -14,31 +18,41 @@ import (
 	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
 )
 
 type Header map[string]string
 
 type OtelLoggerBuilder struct {
-	logExporterOpts    []otlploggrpc.Option
+	endpointUrl        string
+	headers            Header
+	credentials        auth.CredentialProvider
 	serviceName        string
 	useConsoleExporter bool
+	resourceAttrs      []attribute.KeyValue
+	resource           *resource.Resource
+	level              zapcore.Level
+	redactionRules     []RedactionRule
+	recordMetrics      bool
+	recordTemplates    bool
+	semconv            SemconvStability
+	requestIDs         *RequestIDProcessor
+	errs               validation.Errors
 }
 
 func NewOtelLoggerBuilder() *OtelLoggerBuilder {
-	return &OtelLoggerBuilder{}
+	return &OtelLoggerBuilder{level: zap.DebugLevel, headers: Header{}}
 }
 
 func (b *OtelLoggerBuilder) WithEndpointUrl(endpointUrl string) *OtelLoggerBuilder {
-	b.logExporterOpts = append(b.logExporterOpts, otlploggrpc.WithEndpointURL(endpointUrl))
+	b.endpointUrl = endpointUrl
 	return b
 }
 
+// WithHeaders merges headers into those set by earlier calls. Setting the same
+// header twice with different values is reported by Build.
 func (b *OtelLoggerBuilder) WithHeaders(headers Header) *OtelLoggerBuilder {
-	headerMap := make(map[string]string)
-	for key, value := range headers {
-		headerMap[key] = value
-	}
-	b.logExporterOpts = append(b.logExporterOpts, otlploggrpc.WithHeaders(headerMap))
+	validation.MergeHeaders(&b.errs, "WithHeaders", b.headers, headers)
 	return b
 }
 
@@ -48,6 +62,13 @@ func (b *OtelLoggerBuilder) WithAuthHeader(token string) *OtelLoggerBuilder {
 	})
 }
 
+// WithCredentialProvider resolves the Authorization header on every export,
+// so rotated credentials are picked up without a restart.
+func (b *OtelLoggerBuilder) WithCredentialProvider(provider auth.CredentialProvider) *OtelLoggerBuilder {
+	b.credentials = provider
+	return b
+}
+
 func (b *OtelLoggerBuilder) WithServiceName(serviceName string) *OtelLoggerBuilder {
 	b.serviceName = serviceName
 	return b
@@ -58,28 +79,89 @@ func (b *OtelLoggerBuilder) WithConsoleExporter() *OtelLoggerBuilder {
 	return b
 }
 
+// WithResourceAttributes adds attributes to the log resource. They take
+// precedence over the defaults, but not over WithResource.
+func (b *OtelLoggerBuilder) WithResourceAttributes(attrs ...attribute.KeyValue) *OtelLoggerBuilder {
+	b.resourceAttrs = append(b.resourceAttrs, attrs...)
+	return b
+}
+
+// WithResource merges res over the default log resource, so one resource can
+// be shared with the tracer and meter providers. Attributes such as
+// deployment.environment come from here.
+func (b *OtelLoggerBuilder) WithResource(res *resource.Resource) *OtelLoggerBuilder {
+	b.resource = res
+	return b
+}
+
+// WithLevel sets the minimum level written to the console and exported.
+func (b *OtelLoggerBuilder) WithLevel(level zapcore.Level) *OtelLoggerBuilder {
+	b.level = level
+	return b
+}
+
+// WithRedactionRules masks every match of the rules in log messages, string
+// fields and the log.message span attribute.
+func (b *OtelLoggerBuilder) WithRedactionRules(rules ...RedactionRule) *OtelLoggerBuilder {
+	b.redactionRules = append(b.redactionRules, rules...)
+	return b
+}
+
+// WithRecordMetrics counts emitted records in the log.records metric, by
+// severity and logger name, and by the format template of the *f methods when
+// includeTemplate is set. Templates must not embed unbounded values.
+func (b *OtelLoggerBuilder) WithRecordMetrics(includeTemplate bool) *OtelLoggerBuilder {
+	b.recordMetrics = true
+	b.recordTemplates = includeTemplate
+	return b
+}
+
+// WithSemconvStability selects the attribute keys written by LogHttpResponse.
+// The default follows OTEL_SEMCONV_STABILITY_OPT_IN, then SemconvLegacy.
+func (b *OtelLoggerBuilder) WithSemconvStability(stability SemconvStability) *OtelLoggerBuilder {
+	if !stability.valid() {
+		b.errs.Addf("WithSemconvStability", "unknown semconv stability %q", stability)
+	}
+	b.semconv = stability
+	return b
+}
+
 func (b *OtelLoggerBuilder) Build(ctx context.Context) (OtelLogging, error) {
+	logging, _, err := b.BuildWithShutdown(ctx)
+	return logging, err
+}
+
+// BuildWithShutdown is like Build but also returns a function that flushes
+// and shuts down the underlying logger provider.
+func (b *OtelLoggerBuilder) BuildWithShutdown(ctx context.Context) (OtelLogging, func(context.Context) error, error) {
+	if err := b.validate(); err != nil {
+		return nil, nil, fmt.Errorf("invalid logger configuration: %w", err)
+	}
+
+	attrs := []attribute.KeyValue{
+		semconv.ServiceName(b.serviceName),
+		semconv.TelemetrySDKLanguageGo,
+	}
 	res, err := resource.New(ctx,
-		resource.WithAttributes(
-			semconv.ServiceName(b.serviceName),
-			semconv.DeploymentEnvironment("TEST"),
-			semconv.TelemetrySDKLanguageGo,
-		),
+		resource.WithAttributes(append(attrs, b.resourceAttrs...)...),
 	)
+	if err == nil && b.resource != nil {
+		res, err = resource.Merge(res, b.resource)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to create resource: %w", err)
+		return nil, nil, fmt.Errorf("failed to create resource: %w", err)
 	}
 
 	var exporter sdklog.Exporter
 	if b.useConsoleExporter {
 		exporter, err = stdoutlog.New(stdoutlog.WithPrettyPrint())
 		if err != nil {
-			return nil, fmt.Errorf("failed to create stdout exporter: %w", err)
+			return nil, nil, fmt.Errorf("failed to create stdout exporter: %w", err)
 		}
 	} else {
-		exporter, err = otlploggrpc.New(ctx, b.logExporterOpts...)
+		exporter, err = otlploggrpc.New(ctx, b.exporterOptions()...)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create OTLP log exporter with options %v: %w", b.logExporterOpts, err)
+			return nil, nil, fmt.Errorf("failed to create OTLP log exporter for %q: %w", b.endpointUrl, err)
 		}
 	}
 
@@ -90,12 +172,75 @@ func (b *OtelLoggerBuilder) Build(ctx context.Context) (OtelLogging, error) {
 	global.SetLoggerProvider(provider)
 
 	consoleEncoder := zapcore.NewConsoleEncoder(zap.NewDevelopmentEncoderConfig())
-	core := zapcore.NewTee(
-		zapcore.NewCore(consoleEncoder, zapcore.AddSync(zapcore.Lock(os.Stdout)), zap.DebugLevel),
-		otelzap.NewCore(b.serviceName, otelzap.WithLoggerProvider(provider)),
-	)
-	zapLogger := zap.New(core)
+	consoleCore := zapcore.NewCore(consoleEncoder, zapcore.AddSync(zapcore.Lock(os.Stdout)), b.level)
+	otelCore, err := zapcore.NewIncreaseLevelCore(otelzap.NewCore(b.serviceName, otelzap.WithLoggerProvider(provider)), b.level)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to apply log level %s: %w", b.level, err)
+	}
+	if len(b.redactionRules) > 0 {
+		consoleCore = &redactingCore{Core: consoleCore, rules: b.redactionRules}
+		otelCore = &redactingCore{Core: otelCore, rules: b.redactionRules}
+	}
+	zapLogger := zap.New(zapcore.NewTee(consoleCore, otelCore))
 	defer zapLogger.Sync()
 
-	return NewOtelLogging(zapLogger), nil
+	var records *recordCounter
+	if b.recordMetrics {
+		if records, err = newRecordCounter(b.serviceName, b.recordTemplates, zapLogger); err != nil {
+			_ = provider.Shutdown(ctx)
+			return nil, nil, fmt.Errorf("failed to create log record counter: %w", err)
+		}
+	}
+
+	shutdown := func(ctx context.Context) error {
+		_ = zapLogger.Sync()
+		return provider.Shutdown(ctx)
+	}
+	stability := b.semconv
+	if stability == "" {
+		stability = semconvStabilityFromEnv()
+	}
+	return &otelLog{logger: zapLogger, redact: b.redactionRules, records: records, semconv: stability, requestIDs: b.requestIDs}, shutdown, nil
+}
+
+// WithRequestIDProcessor adds the request ID p tracks to records logged with
+// spans of a request. p must also be registered with the tracer provider.
+func (b *OtelLoggerBuilder) WithRequestIDProcessor(p *RequestIDProcessor) *OtelLoggerBuilder {
+	b.requestIDs = p
+	return b
+}
+
+// validate reports every problem with the builder configuration at once,
+// including those recorded by the With* calls.
+func (b *OtelLoggerBuilder) validate() error {
+	errs := append(validation.Errors(nil), b.errs...)
+
+	validation.ValidateExporter(&errs, validation.Exporter{
+		ServiceName: b.serviceName,
+		Endpoint:    b.endpointUrl,
+		Headers:     b.headers,
+		Credentials: b.credentials != nil,
+		Console:     b.useConsoleExporter,
+	})
+	for i, rule := range b.redactionRules {
+		if rule.Pattern == nil {
+			errs.Addf("WithRedactionRules", "rule %d has no pattern", i)
+		}
+	}
+
+	return errs.Err()
+}
+
+func (b *OtelLoggerBuilder) exporterOptions() []otlploggrpc.Option {
+	var opts []otlploggrpc.Option
+	if b.endpointUrl != "" {
+		opts = append(opts, otlploggrpc.WithEndpointURL(b.endpointUrl))
+	}
+	if len(b.headers) > 0 {
+		opts = append(opts, otlploggrpc.WithHeaders(b.headers))
+	}
+	if b.credentials != nil {
+		opts = append(opts, otlploggrpc.WithDialOption(grpc.WithPerRPCCredentials(auth.PerRPCCredentials(b.credentials, b.endpointUrl))))
+	}
+	return opts
 }
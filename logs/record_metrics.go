@@ -0,0 +1,60 @@
+package logs
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// LogRecordsMetric counts emitted log records by severity and logger name.
+const LogRecordsMetric = "log.records"
+
+// recordCounter increments log.records once per OtelLogging call, so the
+// formatted methods, which write two zap entries, still count once.
+type recordCounter struct {
+	counter         metric.Int64Counter
+	logger          attribute.KeyValue
+	includeTemplate bool
+	enabled         func(zapcore.Level) bool
+}
+
+func newRecordCounter(loggerName string, includeTemplate bool, logger *zap.Logger) (*recordCounter, error) {
+	counter, err := otel.Meter("observability/logs").Int64Counter(LogRecordsMetric,
+		metric.WithUnit("{record}"),
+		metric.WithDescription("Number of log records emitted, by severity."),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &recordCounter{
+		counter:         counter,
+		logger:          attribute.String("logger", loggerName),
+		includeTemplate: includeTemplate,
+		enabled:         logger.Core().Enabled,
+	}, nil
+}
+
+// add counts a record at level unless the level is disabled. A nil counter
+// does nothing. The span, if any, lets the count carry an exemplar.
+func (c *recordCounter) add(span trace.Span, level zapcore.Level, template string) {
+	if c == nil || !c.enabled(level) {
+		return
+	}
+	attrs := []attribute.KeyValue{
+		attribute.String("severity", level.CapitalString()),
+		c.logger,
+	}
+	if c.includeTemplate && template != "" {
+		attrs = append(attrs, attribute.String("template", template))
+	}
+	ctx := context.Background()
+	if span != nil {
+		ctx = trace.ContextWithSpan(ctx, span)
+	}
+	c.counter.Add(ctx, 1, metric.WithAttributes(attrs...))
+}
@@ -0,0 +1,61 @@
+package logs
+
+import (
+	"regexp"
+
+	"go.uber.org/zap/zapcore"
+)
+
+const DefaultRedactionReplacement = "[REDACTED]"
+
+type RedactionRule struct {
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+type redactor []RedactionRule
+
+func (r redactor) redact(s string) string {
+	for _, rule := range r {
+		replacement := rule.Replacement
+		if replacement == "" {
+			replacement = DefaultRedactionReplacement
+		}
+		s = rule.Pattern.ReplaceAllString(s, replacement)
+	}
+	return s
+}
+
+// redactingCore applies the redaction rules to the message and string fields
+// of every entry before it reaches the console or the OTel exporter.
+type redactingCore struct {
+	zapcore.Core
+	rules redactor
+}
+
+func (c *redactingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactingCore{Core: c.Core.With(c.redactFields(fields)), rules: c.rules}
+}
+
+func (c *redactingCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c *redactingCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	entry.Message = c.rules.redact(entry.Message)
+	return c.Core.Write(entry, c.redactFields(fields))
+}
+
+func (c *redactingCore) redactFields(fields []zapcore.Field) []zapcore.Field {
+	redacted := make([]zapcore.Field, len(fields))
+	for i, f := range fields {
+		if f.Type == zapcore.StringType {
+			f.String = c.rules.redact(f.String)
+		}
+		redacted[i] = f
+	}
+	return redacted
+}
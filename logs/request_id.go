@@ -0,0 +1,60 @@
+package logs
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// RequestIDBaggageKey is the baggage member carrying the request ID within a
+// request and to downstream services.
+const RequestIDBaggageKey = "request.id"
+
+// RequestIDKey is the span attribute carrying the request ID.
+const RequestIDKey = attribute.Key("http.request_id")
+
+// RequestIDProcessor is a SpanProcessor that gives every span started in a
+// request the request ID from the baggage of its parent context, as the
+// RequestIDKey attribute. It keeps the ID of each span until the span ends,
+// so an OtelLogging built WithRequestIDProcessor adds a request_id field to
+// records logged with any span of the request.
+type RequestIDProcessor struct {
+	ids sync.Map // trace.SpanID -> string
+}
+
+func NewRequestIDProcessor() *RequestIDProcessor {
+	return &RequestIDProcessor{}
+}
+
+func (p *RequestIDProcessor) OnStart(parent context.Context, s sdktrace.ReadWriteSpan) {
+	id := baggage.FromContext(parent).Member(RequestIDBaggageKey).Value()
+	if id == "" {
+		return
+	}
+	s.SetAttributes(RequestIDKey.String(id))
+	p.ids.Store(s.SpanContext().SpanID(), id)
+}
+
+func (p *RequestIDProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	p.ids.Delete(s.SpanContext().SpanID())
+}
+
+func (p *RequestIDProcessor) Shutdown(context.Context) error { return nil }
+
+func (p *RequestIDProcessor) ForceFlush(context.Context) error { return nil }
+
+// field returns the request_id field for span, or a no-op field.
+func (p *RequestIDProcessor) field(span trace.Span) zap.Field {
+	if p == nil || span == nil {
+		return zap.Skip()
+	}
+	if id, ok := p.ids.Load(span.SpanContext().SpanID()); ok {
+		return zap.String("request_id", id.(string))
+	}
+	return zap.Skip()
+}
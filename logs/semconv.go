@@ -0,0 +1,119 @@
+package logs
+
+import (
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+)
+
+// SemconvStability selects the attribute keys LogHttpResponse writes to spans
+// and log records.
+type SemconvStability string
+
+const (
+	// SemconvStable writes the stable HTTP semantic convention keys, such as
+	// http.response.status_code and url.path.
+	SemconvStable SemconvStability = "stable"
+	// SemconvLegacy writes the keys used before, such as http.status_code and
+	// http.path, with snake_case log fields.
+	SemconvLegacy SemconvStability = "legacy"
+	// SemconvDup writes both, for migrating dashboards and alerts.
+	SemconvDup SemconvStability = "dup"
+)
+
+// semconvStabilityFromEnv reads OTEL_SEMCONV_STABILITY_OPT_IN: "http/dup"
+// selects SemconvDup and takes precedence over "http", which selects
+// SemconvStable. Unset or anything else keeps SemconvLegacy.
+func semconvStabilityFromEnv() SemconvStability {
+	stability := SemconvLegacy
+	for _, value := range strings.Split(os.Getenv("OTEL_SEMCONV_STABILITY_OPT_IN"), ",") {
+		switch strings.TrimSpace(value) {
+		case "http/dup":
+			return SemconvDup
+		case "http":
+			stability = SemconvStable
+		}
+	}
+	return stability
+}
+
+func (s SemconvStability) valid() bool {
+	switch s {
+	case SemconvStable, SemconvLegacy, SemconvDup:
+		return true
+	}
+	return false
+}
+
+// httpAttributes collects the span attributes and log fields of an HTTP
+// response under the keys of the configured SemconvStability.
+type httpAttributes struct {
+	legacy, stable bool
+	span           []attribute.KeyValue
+	fields         []zap.Field
+}
+
+func newHTTPAttributes(s SemconvStability) *httpAttributes {
+	return &httpAttributes{legacy: s != SemconvStable, stable: s != SemconvLegacy}
+}
+
+// addLegacy adds a legacy span attribute and log field.
+func (a *httpAttributes) addLegacy(attrKey, fieldKey string, value attribute.Value) {
+	if a.legacy {
+		a.add(attrKey, fieldKey, value)
+	}
+}
+
+// addStable adds a stable key, used for both the span and the log record.
+func (a *httpAttributes) addStable(key string, value attribute.Value) {
+	if a.stable {
+		a.add(key, key, value)
+	}
+}
+
+// addAlways adds keys that don't depend on the SemconvStability.
+func (a *httpAttributes) addAlways(attrKey, fieldKey string, value attribute.Value) {
+	a.add(attrKey, fieldKey, value)
+}
+
+func (a *httpAttributes) add(attrKey, fieldKey string, value attribute.Value) {
+	if !a.has(attrKey) {
+		a.span = append(a.span, attribute.KeyValue{Key: attribute.Key(attrKey), Value: value})
+	}
+	a.fields = append(a.fields, zapField(fieldKey, value))
+}
+
+func (a *httpAttributes) has(key string) bool {
+	for _, kv := range a.span {
+		if string(kv.Key) == key {
+			return true
+		}
+	}
+	return false
+}
+
+func zapField(key string, value attribute.Value) zap.Field {
+	switch value.Type() {
+	case attribute.INT64:
+		return zap.Int64(key, value.AsInt64())
+	case attribute.FLOAT64:
+		return zap.Float64(key, value.AsFloat64())
+	case attribute.BOOL:
+		return zap.Bool(key, value.AsBool())
+	case attribute.STRINGSLICE:
+		return zap.Strings(key, value.AsStringSlice())
+	}
+	return zap.String(key, value.Emit())
+}
+
+// protocolVersion turns "HTTP/1.1" into "1.1" and "HTTP/2.0" into "2", as
+// network.protocol.version expects.
+func protocolVersion(proto string) string {
+	version := strings.TrimPrefix(proto, "HTTP/")
+	if strings.HasSuffix(version, ".0") && version != "1.0" {
+		version = strings.TrimSuffix(version, ".0")
+	}
+	return version
+}
@@ -0,0 +1,389 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+
+	"observability/auth"
+	"observability/validation"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/exemplar"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"google.golang.org/grpc"
+)
+
+type Protocol string
+
+const (
+	ProtocolGRPC Protocol = "grpc"
+	ProtocolHTTP Protocol = "http/protobuf"
+)
+
+type Temporality string
+
+const (
+	TemporalityCumulative Temporality = "cumulative"
+	// TemporalityDelta exports counters and histograms as deltas, as expected
+	// by backends such as Elastic and Datadog.
+	TemporalityDelta Temporality = "delta"
+	// TemporalityLowMemory uses deltas only for synchronous counters and
+	// histograms, which avoids keeping per-series state for them.
+	TemporalityLowMemory Temporality = "lowmemory"
+)
+
+// InstrumentRegistration creates custom instruments on the meter named after
+// the service. It runs once during Build.
+type InstrumentRegistration func(meter metric.Meter) error
+
+type Builder struct {
+	serviceName        string
+	endpointUrl        string
+	headers            map[string]string
+	credentials        auth.CredentialProvider
+	protocol           Protocol
+	temporality        Temporality
+	exportInterval     time.Duration
+	useConsoleExporter bool
+	exportFile         string
+	resource           *resource.Resource
+	readers            []sdkmetric.Reader
+	prometheus         *PrometheusExporter
+	views              []sdkmetric.View
+	instruments        []InstrumentRegistration
+	exemplarFilter     exemplar.Filter
+	runtimeMetrics     bool
+	runtimeInterval    time.Duration
+	errs               validation.Errors
+}
+
+func NewBuilder() *Builder {
+	return &Builder{
+		headers:     map[string]string{},
+		protocol:    ProtocolHTTP,
+		temporality: TemporalityCumulative,
+	}
+}
+
+func (b *Builder) WithServiceName(serviceName string) *Builder {
+	b.serviceName = serviceName
+	return b
+}
+
+func (b *Builder) WithEndpointUrl(endpointUrl string) *Builder {
+	b.endpointUrl = endpointUrl
+	return b
+}
+
+// WithHeaders merges headers into those set by earlier calls. Setting the same
+// header twice with different values is reported by Build.
+func (b *Builder) WithHeaders(headers map[string]string) *Builder {
+	validation.MergeHeaders(&b.errs, "WithHeaders", b.headers, headers)
+	return b
+}
+
+func (b *Builder) WithAuthHeader(token string) *Builder {
+	return b.WithHeaders(map[string]string{
+		"Authorization": "ApiKey " + token,
+	})
+}
+
+func (b *Builder) WithCredentialProvider(provider auth.CredentialProvider) *Builder {
+	b.credentials = provider
+	return b
+}
+
+// WithProtocol selects the OTLP transport. The default is ProtocolHTTP.
+func (b *Builder) WithProtocol(protocol Protocol) *Builder {
+	b.protocol = protocol
+	return b
+}
+
+// WithTemporality selects the aggregation temporality of exported metrics.
+// The default is TemporalityCumulative.
+func (b *Builder) WithTemporality(temporality Temporality) *Builder {
+	b.temporality = temporality
+	return b
+}
+
+// WithExportInterval sets how often metrics are pushed. The default is one minute.
+func (b *Builder) WithExportInterval(interval time.Duration) *Builder {
+	b.exportInterval = interval
+	return b
+}
+
+// WithConsoleExporter writes metrics to stdout as JSON.
+func (b *Builder) WithConsoleExporter() *Builder {
+	b.useConsoleExporter = true
+	return b
+}
+
+// WithFileExporter appends metrics to path as JSON lines.
+func (b *Builder) WithFileExporter(path string) *Builder {
+	b.exportFile = path
+	return b
+}
+
+// WithResource merges res over the default service resource. Attributes such
+// as deployment.environment come from here, as Config.MeterBuilder does with
+// the service section.
+func (b *Builder) WithResource(res *resource.Resource) *Builder {
+	b.resource = res
+	return b
+}
+
+// WithReader adds a reader alongside the push exporter, e.g. a pull-based one.
+func (b *Builder) WithReader(reader sdkmetric.Reader) *Builder {
+	b.readers = append(b.readers, reader)
+	return b
+}
+
+// WithPrometheusExporter exposes metrics for scraping through e. Without an
+// endpoint, console or file exporter, metrics are only scraped, not pushed.
+func (b *Builder) WithPrometheusExporter(e *PrometheusExporter) *Builder {
+	b.prometheus = e
+	return b
+}
+
+// WithViews customizes instruments, such as histogram bucket boundaries.
+func (b *Builder) WithViews(views ...sdkmetric.View) *Builder {
+	b.views = append(b.views, views...)
+	return b
+}
+
+// WithExemplarFilter selects which measurements may become exemplars. By
+// default, measurements made within a sampled span carry its trace and span
+// IDs, unless OTEL_METRICS_EXEMPLAR_FILTER says otherwise.
+func (b *Builder) WithExemplarFilter(filter exemplar.Filter) *Builder {
+	b.exemplarFilter = filter
+	return b
+}
+
+// WithRuntimeMetrics publishes Go runtime and process metrics, read every
+// interval. Zero uses DefaultRuntimeInterval. The go.schedule.duration
+// histogram goes to the exporters of the Builder, not to readers added with
+// WithReader; attach NewRuntimeProducer to those.
+func (b *Builder) WithRuntimeMetrics(interval time.Duration) *Builder {
+	b.runtimeMetrics = true
+	b.runtimeInterval = interval
+	return b
+}
+
+// WithInstruments registers custom instruments once the provider is built.
+func (b *Builder) WithInstruments(register InstrumentRegistration) *Builder {
+	b.instruments = append(b.instruments, register)
+	return b
+}
+
+// Build creates the meter provider and installs it as the global provider.
+// The returned shutdown flushes pending metrics.
+func (b *Builder) Build(ctx context.Context) (metric.MeterProvider, func(context.Context) error, error) {
+	if err := b.validate(); err != nil {
+		return nil, nil, fmt.Errorf("invalid meter configuration: %w", err)
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithAttributes(
+			semconv.ServiceName(b.serviceName),
+			semconv.TelemetrySDKLanguageGo,
+		),
+	)
+	if err == nil && b.resource != nil {
+		res, err = resource.Merge(res, b.resource)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create resource: %w", err)
+	}
+
+	providerOpts := []sdkmetric.Option{
+		sdkmetric.WithResource(res),
+		sdkmetric.WithView(b.views...),
+	}
+	if b.exemplarFilter != nil {
+		providerOpts = append(providerOpts, sdkmetric.WithExemplarFilter(b.exemplarFilter))
+	}
+	var runtimeProducer sdkmetric.Producer
+	if b.runtimeMetrics {
+		runtimeProducer = NewRuntimeProducer()
+	}
+	var closer io.Closer
+	if b.prometheus == nil || b.endpointUrl != "" || b.useConsoleExporter || b.exportFile != "" {
+		var exporter sdkmetric.Exporter
+		exporter, closer, err = b.newExporter(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		var readerOpts []sdkmetric.PeriodicReaderOption
+		if b.exportInterval > 0 {
+			readerOpts = append(readerOpts, sdkmetric.WithInterval(b.exportInterval))
+		}
+		if runtimeProducer != nil {
+			readerOpts = append(readerOpts, sdkmetric.WithProducer(runtimeProducer))
+		}
+		providerOpts = append(providerOpts, sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter, readerOpts...)))
+	}
+	if b.prometheus != nil {
+		providerOpts = append(providerOpts, sdkmetric.WithReader(b.prometheus.reader))
+		if runtimeProducer != nil {
+			b.prometheus.producers = append(b.prometheus.producers, runtimeProducer)
+		}
+	}
+	for _, reader := range b.readers {
+		providerOpts = append(providerOpts, sdkmetric.WithReader(reader))
+	}
+	mp := sdkmetric.NewMeterProvider(providerOpts...)
+
+	registrations := b.instruments
+	if b.runtimeMetrics {
+		registrations = append(slices.Clip(registrations), func(metric.Meter) error {
+			return RegisterRuntimeMetrics(mp.Meter(runtimeScope), b.runtimeInterval)
+		})
+	}
+
+	meter := mp.Meter(b.serviceName)
+	for _, register := range registrations {
+		if err := register(meter); err != nil {
+			_ = mp.Shutdown(ctx)
+			if closer != nil {
+				_ = closer.Close()
+			}
+			return nil, nil, fmt.Errorf("failed to register instruments: %w", err)
+		}
+	}
+
+	shutdown := func(ctx context.Context) error {
+		err := mp.Shutdown(ctx)
+		if closer != nil {
+			err = errors.Join(err, closer.Close())
+		}
+		return err
+	}
+
+	otel.SetMeterProvider(mp)
+	return mp, shutdown, nil
+}
+
+// newExporter also returns the export file, if any, to be closed on shutdown.
+func (b *Builder) newExporter(ctx context.Context) (sdkmetric.Exporter, io.Closer, error) {
+	selector := b.temporalitySelector()
+
+	if b.useConsoleExporter || b.exportFile != "" {
+		var w io.Writer = os.Stdout
+		var closer io.Closer
+		if b.exportFile != "" {
+			f, err := os.OpenFile(b.exportFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to open metric export file: %w", err)
+			}
+			w, closer = f, f
+		}
+		exporter, err := stdoutmetric.New(stdoutmetric.WithWriter(w), stdoutmetric.WithTemporalitySelector(selector))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create stdout exporter: %w", err)
+		}
+		return exporter, closer, nil
+	}
+
+	var exporter sdkmetric.Exporter
+	var err error
+	switch b.protocol {
+	case ProtocolGRPC:
+		opts := []otlpmetricgrpc.Option{otlpmetricgrpc.WithTemporalitySelector(selector)}
+		if b.endpointUrl != "" {
+			opts = append(opts, otlpmetricgrpc.WithEndpointURL(b.endpointUrl))
+		}
+		if len(b.headers) > 0 {
+			opts = append(opts, otlpmetricgrpc.WithHeaders(b.headers))
+		}
+		if b.credentials != nil {
+			opts = append(opts, otlpmetricgrpc.WithDialOption(grpc.WithPerRPCCredentials(auth.PerRPCCredentials(b.credentials, b.endpointUrl))))
+		}
+		exporter, err = otlpmetricgrpc.New(ctx, opts...)
+	default:
+		opts := []otlpmetrichttp.Option{otlpmetrichttp.WithTemporalitySelector(selector)}
+		if b.endpointUrl != "" {
+			opts = append(opts, otlpmetrichttp.WithEndpointURL(b.endpointUrl))
+		}
+		if len(b.headers) > 0 {
+			opts = append(opts, otlpmetrichttp.WithHeaders(b.headers))
+		}
+		if b.credentials != nil {
+			opts = append(opts, otlpmetrichttp.WithHTTPClient(&http.Client{
+				Transport: auth.RoundTripper(b.credentials, nil),
+			}))
+		}
+		exporter, err = otlpmetrichttp.New(ctx, opts...)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create OTLP metric exporter for %q: %w", b.endpointUrl, err)
+	}
+	return exporter, nil, nil
+}
+
+func (b *Builder) temporalitySelector() sdkmetric.TemporalitySelector {
+	switch b.temporality {
+	case TemporalityDelta:
+		return func(kind sdkmetric.InstrumentKind) metricdata.Temporality {
+			switch kind {
+			case sdkmetric.InstrumentKindUpDownCounter, sdkmetric.InstrumentKindObservableUpDownCounter:
+				return metricdata.CumulativeTemporality
+			}
+			return metricdata.DeltaTemporality
+		}
+	case TemporalityLowMemory:
+		return func(kind sdkmetric.InstrumentKind) metricdata.Temporality {
+			switch kind {
+			case sdkmetric.InstrumentKindCounter, sdkmetric.InstrumentKindHistogram:
+				return metricdata.DeltaTemporality
+			}
+			return metricdata.CumulativeTemporality
+		}
+	default:
+		return sdkmetric.DefaultTemporalitySelector
+	}
+}
+
+func (b *Builder) validate() error {
+	errs := append(validation.Errors(nil), b.errs...)
+
+	validation.ValidateExporter(&errs, validation.Exporter{
+		ServiceName: b.serviceName,
+		Endpoint:    b.endpointUrl,
+		Headers:     b.headers,
+		Credentials: b.credentials != nil,
+		Console:     b.useConsoleExporter,
+		File:        b.exportFile != "",
+	})
+	switch b.protocol {
+	case ProtocolGRPC, ProtocolHTTP:
+	default:
+		errs.Addf("WithProtocol", "unknown protocol %q, expected %q or %q", b.protocol, ProtocolGRPC, ProtocolHTTP)
+	}
+	switch b.temporality {
+	case TemporalityCumulative, TemporalityDelta, TemporalityLowMemory:
+	default:
+		errs.Addf("WithTemporality", "unknown temporality %q, expected %q, %q or %q",
+			b.temporality, TemporalityCumulative, TemporalityDelta, TemporalityLowMemory)
+	}
+	if b.exportInterval < 0 {
+		errs.Addf("WithExportInterval", "must not be negative")
+	}
+	if b.runtimeInterval < 0 {
+		errs.Addf("WithRuntimeMetrics", "interval must not be negative")
+	}
+
+	return errs.Err()
+}
@@ -0,0 +1,384 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	prometheusContentType  = "text/plain; version=0.0.4; charset=utf-8"
+	openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+// PrometheusExporter serves metrics for scraping, in the Prometheus text
+// format or, when the scraper accepts it, OpenMetrics with exemplars. Register
+// it with Builder.WithPrometheusExporter and mount it on the service mux.
+type PrometheusExporter struct {
+	reader *sdkmetric.ManualReader
+	// producers are set by the Builder, after the reader was created.
+	producers []sdkmetric.Producer
+}
+
+func NewPrometheusExporter() *PrometheusExporter {
+	return &PrometheusExporter{reader: sdkmetric.NewManualReader()}
+}
+
+func (e *PrometheusExporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var rm metricdata.ResourceMetrics
+	if err := e.reader.Collect(r.Context(), &rm); err != nil {
+		http.Error(w, fmt.Sprintf("failed to collect metrics: %v", err), http.StatusInternalServerError)
+		return
+	}
+	for _, p := range e.producers {
+		scopes, err := p.Produce(r.Context())
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to collect metrics: %v", err), http.StatusInternalServerError)
+			return
+		}
+		rm.ScopeMetrics = append(rm.ScopeMetrics, scopes...)
+	}
+
+	openMetrics := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+	var buf bytes.Buffer
+	for _, f := range toPromFamilies(rm) {
+		f.write(&buf, openMetrics)
+	}
+	if openMetrics {
+		buf.WriteString("# EOF\n")
+		w.Header().Set("Content-Type", openMetricsContentType)
+	} else {
+		w.Header().Set("Content-Type", prometheusContentType)
+	}
+	_, _ = w.Write(buf.Bytes())
+}
+
+type promLabel struct {
+	name, value string
+}
+
+type promExemplar struct {
+	labels []promLabel
+	value  float64
+	time   float64
+}
+
+type promSample struct {
+	suffix   string
+	labels   []promLabel
+	value    float64
+	exemplar *promExemplar
+}
+
+// promFamily is named without the _total or _info suffix, as in OpenMetrics.
+type promFamily struct {
+	name    string
+	typ     string
+	help    string
+	samples []promSample
+}
+
+func (f *promFamily) write(buf *bytes.Buffer, openMetrics bool) {
+	name, typ := f.name, f.typ
+	if !openMetrics {
+		switch typ {
+		case "counter":
+			name += "_total"
+		case "info":
+			name, typ = name+"_info", "gauge"
+		}
+	}
+	if f.help != "" {
+		fmt.Fprintf(buf, "# HELP %s %s\n", name, escapeHelp(f.help))
+	}
+	fmt.Fprintf(buf, "# TYPE %s %s\n", name, typ)
+
+	for _, s := range f.samples {
+		buf.WriteString(f.name + s.suffix)
+		writeLabels(buf, s.labels)
+		buf.WriteByte(' ')
+		buf.WriteString(formatFloat(s.value))
+		// Exemplars are only part of the OpenMetrics format.
+		if openMetrics && s.exemplar != nil {
+			buf.WriteString(" # ")
+			// OpenMetrics requires the label set, even when it is empty.
+			if len(s.exemplar.labels) == 0 {
+				buf.WriteString("{}")
+			}
+			writeLabels(buf, s.exemplar.labels)
+			buf.WriteByte(' ')
+			buf.WriteString(formatFloat(s.exemplar.value))
+			buf.WriteByte(' ')
+			buf.WriteString(strconv.FormatFloat(s.exemplar.time, 'f', -1, 64))
+		}
+		buf.WriteByte('\n')
+	}
+}
+
+func writeLabels(buf *bytes.Buffer, labels []promLabel) {
+	if len(labels) == 0 {
+		return
+	}
+	buf.WriteByte('{')
+	for i, l := range labels {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(l.name)
+		buf.WriteString(`="`)
+		buf.WriteString(escapeLabelValue(l.value))
+		buf.WriteByte('"')
+	}
+	buf.WriteByte('}')
+}
+
+// toPromFamilies converts collected metrics to families, merging metrics of
+// the same name from different scopes. The resource becomes target_info.
+func toPromFamilies(rm metricdata.ResourceMetrics) []*promFamily {
+	var families []*promFamily
+	byName := map[string]*promFamily{}
+	family := func(name, typ, help string) *promFamily {
+		if f, ok := byName[name]; ok {
+			return f
+		}
+		f := &promFamily{name: name, typ: typ, help: help}
+		byName[name] = f
+		families = append(families, f)
+		return f
+	}
+
+	if rm.Resource != nil && rm.Resource.Len() > 0 {
+		f := family("target", "info", "Target metadata")
+		f.samples = append(f.samples, promSample{
+			suffix: "_info",
+			labels: toPromLabels(rm.Resource.Attributes()),
+			value:  1,
+		})
+	}
+
+	for _, sm := range rm.ScopeMetrics {
+		var scopeLabels []promLabel
+		if sm.Scope.Name != "" {
+			scopeLabels = append(scopeLabels, promLabel{"otel_scope_name", sm.Scope.Name})
+		}
+		if sm.Scope.Version != "" {
+			scopeLabels = append(scopeLabels, promLabel{"otel_scope_version", sm.Scope.Version})
+		}
+
+		for _, m := range sm.Metrics {
+			name := promName(m.Name, m.Unit)
+			switch data := m.Data.(type) {
+			case metricdata.Sum[int64]:
+				addSum(family, name, m.Description, data, scopeLabels)
+			case metricdata.Sum[float64]:
+				addSum(family, name, m.Description, data, scopeLabels)
+			case metricdata.Gauge[int64]:
+				addGauge(family(name, "gauge", m.Description), data, scopeLabels)
+			case metricdata.Gauge[float64]:
+				addGauge(family(name, "gauge", m.Description), data, scopeLabels)
+			case metricdata.Histogram[int64]:
+				addHistogram(family(name, "histogram", m.Description), data, scopeLabels)
+			case metricdata.Histogram[float64]:
+				addHistogram(family(name, "histogram", m.Description), data, scopeLabels)
+			}
+			// Exponential histograms and summaries have no text-format
+			// equivalent and are left to push exporters.
+		}
+	}
+	return families
+}
+
+func addSum[N int64 | float64](family func(name, typ, help string) *promFamily, name, help string, data metricdata.Sum[N], scope []promLabel) {
+	// Only monotonic cumulative sums are counters; anything else can go
+	// down between scrapes and is exposed as a gauge.
+	if !data.IsMonotonic || data.Temporality != metricdata.CumulativeTemporality {
+		f := family(name, "gauge", help)
+		for _, dp := range data.DataPoints {
+			f.samples = append(f.samples, promSample{
+				labels: append(toPromLabels(dp.Attributes.ToSlice()), scope...),
+				value:  float64(dp.Value),
+			})
+		}
+		return
+	}
+
+	f := family(strings.TrimSuffix(name, "_total"), "counter", help)
+	for _, dp := range data.DataPoints {
+		s := promSample{
+			suffix: "_total",
+			labels: append(toPromLabels(dp.Attributes.ToSlice()), scope...),
+			value:  float64(dp.Value),
+		}
+		for _, ex := range dp.Exemplars {
+			if s.exemplar == nil || s.exemplar.time < unixSeconds(ex.Time) {
+				s.exemplar = toPromExemplar(ex)
+			}
+		}
+		f.samples = append(f.samples, s)
+	}
+}
+
+func addGauge[N int64 | float64](f *promFamily, data metricdata.Gauge[N], scope []promLabel) {
+	for _, dp := range data.DataPoints {
+		f.samples = append(f.samples, promSample{
+			labels: append(toPromLabels(dp.Attributes.ToSlice()), scope...),
+			value:  float64(dp.Value),
+		})
+	}
+}
+
+func addHistogram[N int64 | float64](f *promFamily, data metricdata.Histogram[N], scope []promLabel) {
+	for _, dp := range data.DataPoints {
+		labels := append(toPromLabels(dp.Attributes.ToSlice()), scope...)
+
+		// Keep the latest exemplar falling into each bucket.
+		exemplars := make([]*promExemplar, len(dp.BucketCounts))
+		for _, ex := range dp.Exemplars {
+			i, _ := slices.BinarySearch(dp.Bounds, float64(ex.Value))
+			if i < len(exemplars) && (exemplars[i] == nil || exemplars[i].time < unixSeconds(ex.Time)) {
+				exemplars[i] = toPromExemplar(ex)
+			}
+		}
+
+		var cumulative uint64
+		for i, count := range dp.BucketCounts {
+			cumulative += count
+			le := "+Inf"
+			if i < len(dp.Bounds) {
+				le = formatFloat(dp.Bounds[i])
+			}
+			f.samples = append(f.samples, promSample{
+				suffix:   "_bucket",
+				labels:   append(slices.Clone(labels), promLabel{"le", le}),
+				value:    float64(cumulative),
+				exemplar: exemplars[i],
+			})
+		}
+		f.samples = append(f.samples,
+			promSample{suffix: "_sum", labels: labels, value: float64(dp.Sum)},
+			promSample{suffix: "_count", labels: labels, value: float64(dp.Count)},
+		)
+	}
+}
+
+// toPromExemplar keeps only the trace and span IDs, as OpenMetrics limits the
+// size of exemplar labels.
+func toPromExemplar[N int64 | float64](ex metricdata.Exemplar[N]) *promExemplar {
+	var labels []promLabel
+	if len(ex.TraceID) == len(trace.TraceID{}) {
+		labels = append(labels, promLabel{"trace_id", trace.TraceID(ex.TraceID).String()})
+	}
+	if len(ex.SpanID) == len(trace.SpanID{}) {
+		labels = append(labels, promLabel{"span_id", trace.SpanID(ex.SpanID).String()})
+	}
+	return &promExemplar{
+		labels: labels,
+		value:  float64(ex.Value),
+		time:   unixSeconds(ex.Time),
+	}
+}
+
+func unixSeconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / 1e9
+}
+
+// toPromLabels sanitizes attribute keys into label names. Keys that collide
+// after sanitizing have their values joined with ";".
+func toPromLabels(attrs []attribute.KeyValue) []promLabel {
+	labels := make([]promLabel, 0, len(attrs))
+	index := map[string]int{}
+	for _, attr := range attrs {
+		name := sanitize(string(attr.Key), false)
+		if i, ok := index[name]; ok {
+			labels[i].value += ";" + attr.Value.Emit()
+			continue
+		}
+		index[name] = len(labels)
+		labels = append(labels, promLabel{name, attr.Value.Emit()})
+	}
+	return labels
+}
+
+var unitSuffixes = map[string]string{
+	"s":    "seconds",
+	"ms":   "milliseconds",
+	"us":   "microseconds",
+	"ns":   "nanoseconds",
+	"By":   "bytes",
+	"KiBy": "kibibytes",
+	"MiBy": "mebibytes",
+	"%":    "percent",
+}
+
+// promName follows the OpenTelemetry to Prometheus naming rules: invalid
+// characters become "_" and the unit is appended as a suffix. Annotations
+// such as "{request}" and the dimensionless unit "1" add no suffix.
+func promName(name, unit string) string {
+	n := sanitize(name, true)
+	suffix, ok := unitSuffixes[unit]
+	if !ok && unit != "1" && !strings.HasPrefix(unit, "{") {
+		suffix = sanitize(unit, false)
+	}
+	if suffix != "" && !strings.HasSuffix(n, "_"+suffix) {
+		n += "_" + suffix
+	}
+	return n
+}
+
+// sanitize replaces characters not allowed in metric names (or, without
+// colons, label names) with "_", collapsing repeats.
+func sanitize(s string, allowColon bool) string {
+	var b strings.Builder
+	for i, r := range s {
+		valid := r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') ||
+			(i > 0 && r >= '0' && r <= '9') || (allowColon && r == ':')
+		if !valid {
+			if i == 0 && r >= '0' && r <= '9' {
+				b.WriteByte('_')
+				b.WriteRune(r)
+				continue
+			}
+			r = '_'
+		}
+		if r == '_' && strings.HasSuffix(b.String(), "_") {
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return labelEscaper.Replace(s)
+}
@@ -0,0 +1,113 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+func TestPrometheusExposition(t *testing.T) {
+	traceID := []byte{0x80, 0xf1, 0x98, 0xee, 0x56, 0x34, 0x3b, 0xa8, 0x64, 0xfe, 0x8b, 0x2a, 0x57, 0xd3, 0xef, 0xf7}
+	spanID := []byte{0xe4, 0x57, 0xb5, 0xa2, 0xe4, 0xd8, 0x6b, 0xd1}
+
+	histogram := metricdata.ResourceMetrics{
+		ScopeMetrics: []metricdata.ScopeMetrics{{
+			Scope: instrumentation.Scope{Name: "http", Version: "1.0.0"},
+			Metrics: []metricdata.Metrics{{
+				Name:        "http.server.request.duration",
+				Description: "Duration of HTTP server requests.",
+				Unit:        "s",
+				Data: metricdata.Histogram[float64]{
+					Temporality: metricdata.CumulativeTemporality,
+					DataPoints: []metricdata.HistogramDataPoint[float64]{{
+						Attributes:   attribute.NewSet(attribute.String("http.request.method", "GET")),
+						Bounds:       []float64{0.1, 0.5},
+						BucketCounts: []uint64{2, 1, 1},
+						Count:        4,
+						Sum:          1.35,
+						Exemplars: []metricdata.Exemplar[float64]{
+							{Value: 0.05, Time: time.Unix(1700000000, 0), TraceID: traceID, SpanID: spanID},
+							{Value: 0.07, Time: time.Unix(1700000001, 500000000), TraceID: traceID, SpanID: spanID},
+							{Value: 1.1, Time: time.Unix(1700000002, 0)},
+						},
+					}},
+				},
+			}},
+		}},
+	}
+
+	info := metricdata.ResourceMetrics{
+		Resource: resource.NewSchemaless(
+			attribute.String("service.name", "checkout"),
+			attribute.String("service.version", "1.2.3"),
+			attribute.String("deployment.environment", `prod "eu"`),
+		),
+	}
+
+	tests := []struct {
+		name        string
+		rm          metricdata.ResourceMetrics
+		openMetrics bool
+		want        string
+	}{
+		{
+			name: "histogram text",
+			rm:   histogram,
+			want: `# HELP http_server_request_duration_seconds Duration of HTTP server requests.
+# TYPE http_server_request_duration_seconds histogram
+http_server_request_duration_seconds_bucket{http_request_method="GET",otel_scope_name="http",otel_scope_version="1.0.0",le="0.1"} 2
+http_server_request_duration_seconds_bucket{http_request_method="GET",otel_scope_name="http",otel_scope_version="1.0.0",le="0.5"} 3
+http_server_request_duration_seconds_bucket{http_request_method="GET",otel_scope_name="http",otel_scope_version="1.0.0",le="+Inf"} 4
+http_server_request_duration_seconds_sum{http_request_method="GET",otel_scope_name="http",otel_scope_version="1.0.0"} 1.35
+http_server_request_duration_seconds_count{http_request_method="GET",otel_scope_name="http",otel_scope_version="1.0.0"} 4
+`,
+		},
+		{
+			name:        "histogram with exemplars",
+			rm:          histogram,
+			openMetrics: true,
+			want: `# HELP http_server_request_duration_seconds Duration of HTTP server requests.
+# TYPE http_server_request_duration_seconds histogram
+http_server_request_duration_seconds_bucket{http_request_method="GET",otel_scope_name="http",otel_scope_version="1.0.0",le="0.1"} 2 # {trace_id="80f198ee56343ba864fe8b2a57d3eff7",span_id="e457b5a2e4d86bd1"} 0.07 1700000001.5
+http_server_request_duration_seconds_bucket{http_request_method="GET",otel_scope_name="http",otel_scope_version="1.0.0",le="0.5"} 3
+http_server_request_duration_seconds_bucket{http_request_method="GET",otel_scope_name="http",otel_scope_version="1.0.0",le="+Inf"} 4 # {} 1.1 1700000002
+http_server_request_duration_seconds_sum{http_request_method="GET",otel_scope_name="http",otel_scope_version="1.0.0"} 1.35
+http_server_request_duration_seconds_count{http_request_method="GET",otel_scope_name="http",otel_scope_version="1.0.0"} 4
+`,
+		},
+		{
+			name: "target_info text",
+			rm:   info,
+			want: `# HELP target_info Target metadata
+# TYPE target_info gauge
+target_info{deployment_environment="prod \"eu\"",service_name="checkout",service_version="1.2.3"} 1
+`,
+		},
+		{
+			name:        "target_info OpenMetrics",
+			rm:          info,
+			openMetrics: true,
+			want: `# HELP target Target metadata
+# TYPE target info
+target_info{deployment_environment="prod \"eu\"",service_name="checkout",service_version="1.2.3"} 1
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			for _, f := range toPromFamilies(tt.rm) {
+				f.write(&buf, tt.openMetrics)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("exposition mismatch\ngot:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,329 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	rtmetrics "runtime/metrics"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// DefaultRuntimeInterval is how often runtime metrics are read when no
+// interval is given.
+const DefaultRuntimeInterval = 15 * time.Second
+
+// clockTicks is USER_HZ, the unit of the CPU times in /proc/self/stat. It is
+// 100 on every mainstream Linux architecture.
+const clockTicks = 100
+
+const (
+	goMemoryTotal    = "/memory/classes/total:bytes"
+	goMemoryReleased = "/memory/classes/heap/released:bytes"
+	goMemoryStacks   = "/memory/classes/heap/stacks:bytes"
+	goMemoryOSStacks = "/memory/classes/os-stacks:bytes"
+	goMemoryLimit    = "/gc/gomemlimit:bytes"
+	goHeapGoal       = "/gc/heap/goal:bytes"
+	goAllocBytes     = "/gc/heap/allocs:bytes"
+	goAllocObjects   = "/gc/heap/allocs:objects"
+	goGCCycles       = "/gc/cycles/total:gc-cycles"
+	goGOGC           = "/gc/gogc:percent"
+	goGoroutines     = "/sched/goroutines:goroutines"
+	goMaxProcs       = "/sched/gomaxprocs:threads"
+	goSchedLatencies = "/sched/latencies:seconds"
+)
+
+// runtimeCollector reads runtime/metrics at most once per interval, however
+// many readers collect from the meter provider.
+type runtimeCollector struct {
+	interval time.Duration
+
+	mu       sync.Mutex
+	lastRead time.Time
+	samples  []rtmetrics.Sample
+	index    map[string]int
+}
+
+// RegisterRuntimeMetrics publishes Go runtime metrics under the go.* names of
+// the semantic conventions, plus process CPU time and memory usage read from
+// /proc/self where available. The go.schedule.duration histogram can't be
+// observed through the metric API; it comes from NewRuntimeProducer, which
+// the Builder attaches to its readers.
+func RegisterRuntimeMetrics(meter metric.Meter, interval time.Duration) error {
+	if interval <= 0 {
+		interval = DefaultRuntimeInterval
+	}
+	c := &runtimeCollector{
+		interval: interval,
+		index:    map[string]int{},
+	}
+
+	supported := map[string]bool{}
+	for _, d := range rtmetrics.All() {
+		supported[d.Name] = true
+	}
+	for _, name := range []string{
+		goMemoryTotal, goMemoryReleased, goMemoryStacks, goMemoryOSStacks, goMemoryLimit, goHeapGoal,
+		goAllocBytes, goAllocObjects, goGCCycles, goGOGC, goGoroutines, goMaxProcs,
+	} {
+		if supported[name] {
+			c.index[name] = len(c.samples)
+			c.samples = append(c.samples, rtmetrics.Sample{Name: name})
+		}
+	}
+
+	var errs []error
+	gauge := func(name, unit, desc string) metric.Int64ObservableGauge {
+		g, err := meter.Int64ObservableGauge(name, metric.WithUnit(unit), metric.WithDescription(desc))
+		errs = append(errs, err)
+		return g
+	}
+	counter := func(name, unit, desc string) metric.Int64ObservableCounter {
+		cnt, err := meter.Int64ObservableCounter(name, metric.WithUnit(unit), metric.WithDescription(desc))
+		errs = append(errs, err)
+		return cnt
+	}
+
+	memUsed, err := meter.Int64ObservableUpDownCounter("go.memory.used",
+		metric.WithUnit("By"), metric.WithDescription("Memory used by the Go runtime."))
+	errs = append(errs, err)
+	memLimit := gauge("go.memory.limit", "By", "Go runtime memory limit configured by the user, if a limit exists.")
+	heapGoal := gauge("go.memory.gc.goal", "By", "Heap size target for the end of the GC cycle.")
+	allocBytes := counter("go.memory.allocated", "By", "Memory allocated to the heap by the application.")
+	allocObjects := counter("go.memory.allocations", "{allocation}", "Count of allocations to the heap by the application.")
+	gcCycles := counter("go.gc.count", "{gc_cycle}", "Count of completed GC cycles.")
+	gogc := gauge("go.config.gogc", "%", "Heap size target percentage configured by the user, otherwise 100.")
+	goroutines := gauge("go.goroutine.count", "{goroutine}", "Count of live goroutines.")
+	maxProcs := gauge("go.processor.limit", "{thread}", "The number of OS threads that can execute user-level Go code simultaneously.")
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("failed to create runtime instruments: %w", err)
+	}
+
+	stackAttrs := metric.WithAttributes(attribute.String("go.memory.type", "stack"))
+	otherAttrs := metric.WithAttributes(attribute.String("go.memory.type", "other"))
+	_, err = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.refresh()
+
+		if total, ok := c.uint(goMemoryTotal); ok {
+			released, _ := c.uint(goMemoryReleased)
+			stacks, _ := c.uint(goMemoryStacks)
+			osStacks, _ := c.uint(goMemoryOSStacks)
+			o.ObserveInt64(memUsed, int64(stacks+osStacks), stackAttrs)
+			o.ObserveInt64(memUsed, int64(total-released-stacks-osStacks), otherAttrs)
+		}
+		// A memory limit of math.MaxInt64 means none is set.
+		if limit, ok := c.uint(goMemoryLimit); ok && limit != math.MaxInt64 {
+			o.ObserveInt64(memLimit, int64(limit))
+		}
+		for inst, name := range map[metric.Int64Observable]string{
+			heapGoal:     goHeapGoal,
+			allocBytes:   goAllocBytes,
+			allocObjects: goAllocObjects,
+			gcCycles:     goGCCycles,
+			gogc:         goGOGC,
+			goroutines:   goGoroutines,
+			maxProcs:     goMaxProcs,
+		} {
+			if v, ok := c.uint(name); ok {
+				o.ObserveInt64(inst, int64(v))
+			}
+		}
+		return nil
+	}, memUsed, memLimit, heapGoal, allocBytes, allocObjects, gcCycles, gogc, goroutines, maxProcs)
+	if err != nil {
+		return fmt.Errorf("failed to register runtime metrics callback: %w", err)
+	}
+
+	return registerProcessMetrics(meter)
+}
+
+// refresh re-reads the runtime metrics once the interval has passed. c.mu
+// must be held.
+func (c *runtimeCollector) refresh() {
+	if !c.lastRead.IsZero() && time.Since(c.lastRead) < c.interval {
+		return
+	}
+	c.lastRead = time.Now()
+	rtmetrics.Read(c.samples)
+}
+
+func (c *runtimeCollector) uint(name string) (uint64, bool) {
+	i, ok := c.index[name]
+	if !ok || c.samples[i].Value.Kind() != rtmetrics.KindUint64 {
+		return 0, false
+	}
+	return c.samples[i].Value.Uint64(), true
+}
+
+// runtimeScope is the instrumentation scope of the runtime metrics.
+const runtimeScope = "observability/metrics/runtime"
+
+// schedLatencyBounds are the go.schedule.duration buckets, in seconds. The
+// runtime histogram has about 160 buckets, too many to export as series.
+var schedLatencyBounds = []float64{1e-6, 1e-5, 1e-4, 5e-4, 1e-3, 5e-3, 1e-2, 5e-2, 1e-1, 1}
+
+type runtimeProducer struct {
+	start time.Time
+}
+
+// NewRuntimeProducer returns a producer of the go.schedule.duration histogram,
+// converted from the runtime/metrics scheduling latency histogram. Attach it
+// with sdkmetric.WithProducer to readers not created by the Builder. The
+// histogram is cumulative whatever the reader's temporality, and its sum is
+// estimated from the bucket midpoints, since the runtime doesn't track it.
+func NewRuntimeProducer() sdkmetric.Producer {
+	return &runtimeProducer{start: time.Now()}
+}
+
+func (p *runtimeProducer) Produce(context.Context) ([]metricdata.ScopeMetrics, error) {
+	sample := []rtmetrics.Sample{{Name: goSchedLatencies}}
+	rtmetrics.Read(sample)
+	if sample[0].Value.Kind() != rtmetrics.KindFloat64Histogram {
+		return nil, nil
+	}
+	h := sample[0].Value.Float64Histogram()
+
+	dp := metricdata.HistogramDataPoint[float64]{
+		StartTime:    p.start,
+		Time:         time.Now(),
+		Bounds:       schedLatencyBounds,
+		BucketCounts: make([]uint64, len(schedLatencyBounds)+1),
+	}
+	for i, n := range h.Counts {
+		if n == 0 {
+			continue
+		}
+		// Runtime bucket i spans Buckets[i] to Buckets[i+1]. It is counted in
+		// the first bucket whose bound is not below its upper end, so runtime
+		// buckets straddling a bound round up.
+		upper := h.Buckets[i+1]
+		j, _ := slices.BinarySearch(schedLatencyBounds, upper)
+		dp.BucketCounts[j] += n
+		dp.Count += n
+		dp.Sum += float64(n) * bucketMidpoint(h.Buckets[i], upper)
+	}
+
+	return []metricdata.ScopeMetrics{{
+		Scope: instrumentation.Scope{Name: runtimeScope},
+		Metrics: []metricdata.Metrics{{
+			Name:        "go.schedule.duration",
+			Description: "The time goroutines have spent in the scheduler in a runnable state before actually running.",
+			Unit:        "s",
+			Data: metricdata.Histogram[float64]{
+				Temporality: metricdata.CumulativeTemporality,
+				DataPoints:  []metricdata.HistogramDataPoint[float64]{dp},
+			},
+		}},
+	}}, nil
+}
+
+// bucketMidpoint falls back to the finite bound of the open-ended buckets.
+func bucketMidpoint(lower, upper float64) float64 {
+	switch {
+	case math.IsInf(lower, -1):
+		return max(upper, 0)
+	case math.IsInf(upper, 1):
+		return lower
+	}
+	return (lower + upper) / 2
+}
+
+// registerProcessMetrics reports CPU time and memory usage from /proc/self.
+// It does nothing on systems without procfs.
+func registerProcessMetrics(meter metric.Meter) error {
+	if _, err := os.Stat("/proc/self/stat"); err != nil {
+		return nil
+	}
+
+	cpuTime, err := meter.Float64ObservableCounter("process.cpu.time",
+		metric.WithUnit("s"), metric.WithDescription("Total CPU seconds broken down by different CPU modes."))
+	if err != nil {
+		return fmt.Errorf("failed to create process instruments: %w", err)
+	}
+	memUsage, err := meter.Int64ObservableUpDownCounter("process.memory.usage",
+		metric.WithUnit("By"), metric.WithDescription("The amount of physical memory in use."))
+	if err != nil {
+		return fmt.Errorf("failed to create process instruments: %w", err)
+	}
+	memVirtual, err := meter.Int64ObservableUpDownCounter("process.memory.virtual",
+		metric.WithUnit("By"), metric.WithDescription("The amount of committed virtual memory."))
+	if err != nil {
+		return fmt.Errorf("failed to create process instruments: %w", err)
+	}
+
+	userAttrs := metric.WithAttributes(attribute.String("cpu.mode", "user"))
+	systemAttrs := metric.WithAttributes(attribute.String("cpu.mode", "system"))
+	pageSize := int64(os.Getpagesize())
+	_, err = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		if user, system, err := readProcCPU(); err == nil {
+			o.ObserveFloat64(cpuTime, user, userAttrs)
+			o.ObserveFloat64(cpuTime, system, systemAttrs)
+		}
+		if size, resident, err := readProcMemory(); err == nil {
+			o.ObserveInt64(memUsage, resident*pageSize)
+			o.ObserveInt64(memVirtual, size*pageSize)
+		}
+		return nil
+	}, cpuTime, memUsage, memVirtual)
+	if err != nil {
+		return fmt.Errorf("failed to register process metrics callback: %w", err)
+	}
+	return nil
+}
+
+// readProcCPU returns utime and stime, in seconds, from /proc/self/stat.
+func readProcCPU() (user, system float64, err error) {
+	data, err := os.ReadFile("/proc/self/stat")
+	if err != nil {
+		return 0, 0, err
+	}
+	// The command name in the second field may contain spaces, so fields are
+	// counted from its closing parenthesis; utime and stime are fields 14 and 15.
+	s := string(data)
+	fields := strings.Fields(s[strings.LastIndexByte(s, ')')+1:])
+	if len(fields) < 13 {
+		return 0, 0, fmt.Errorf("unexpected /proc/self/stat format")
+	}
+	utime, err := strconv.ParseUint(fields[11], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	stime, err := strconv.ParseUint(fields[12], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	return float64(utime) / clockTicks, float64(stime) / clockTicks, nil
+}
+
+// readProcMemory returns the total and resident program size, in pages, from
+// /proc/self/statm.
+func readProcMemory() (size, resident int64, err error) {
+	data, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0, 0, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 2 {
+		return 0, 0, fmt.Errorf("unexpected /proc/self/statm format")
+	}
+	if size, err = strconv.ParseInt(fields[0], 10, 64); err != nil {
+		return 0, 0, err
+	}
+	if resident, err = strconv.ParseInt(fields[1], 10, 64); err != nil {
+		return 0, 0, err
+	}
+	return size, resident, nil
+}
@@ -0,0 +1,174 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ClientIPResolver finds the address of the client behind trusted proxies.
+// Forwarding headers are only honoured when the peer is a trusted proxy, and
+// are read right to left, so entries added by the client can't spoof its
+// address. Forwarded takes precedence over X-Forwarded-For, which takes
+// precedence over X-Real-IP. The scheme is taken from the hop of the client.
+type ClientIPResolver struct {
+	trusted []netip.Prefix
+}
+
+// NewClientIPResolver returns a resolver trusting proxies within the given
+// prefixes. Without prefixes the client is always the peer.
+func NewClientIPResolver(trusted ...netip.Prefix) *ClientIPResolver {
+	return &ClientIPResolver{trusted: trusted}
+}
+
+// Resolve returns the client address and the network peer address of r,
+// both without a port. IPv4-mapped client addresses are returned as IPv4.
+func (c *ClientIPResolver) Resolve(r *http.Request) (client, peer string) {
+	client, peer, _ = c.resolve(r)
+	return client, peer
+}
+
+// Scheme returns the scheme the client used: the proto a trusted proxy
+// recorded for it in Forwarded or X-Forwarded-Proto, or else the scheme of
+// the connection.
+func (c *ClientIPResolver) Scheme(r *http.Request) string {
+	if _, _, proto := c.resolve(r); proto == "http" || proto == "https" {
+		return proto
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// resolve walks the hops right to left to the first untrusted one, which is
+// the client, and returns the proto its proxy recorded, lower-cased.
+func (c *ClientIPResolver) resolve(r *http.Request) (client, peer, proto string) {
+	peer = stripPort(r.RemoteAddr)
+	if !c.isTrusted(peer) {
+		return unmap(peer), peer, ""
+	}
+
+	var hops []hop
+	if values := r.Header.Values("Forwarded"); len(values) > 0 {
+		hops = forwarded(values)
+	} else if values := r.Header.Values("X-Forwarded-For"); len(values) > 0 {
+		for _, value := range values {
+			for _, addr := range strings.Split(value, ",") {
+				hops = append(hops, hop{addr: addr})
+			}
+		}
+		setForwardedProto(hops, r.Header.Values("X-Forwarded-Proto"))
+	} else if value := r.Header.Get("X-Real-IP"); value != "" {
+		hops = []hop{{addr: value}}
+		setForwardedProto(hops, r.Header.Values("X-Forwarded-Proto"))
+	}
+
+	client = unmap(peer)
+	for i := len(hops) - 1; i >= 0; i-- {
+		host := stripPort(strings.TrimSpace(hops[i].addr))
+		if host == "" {
+			// Empty list elements, as in "1.2.3.4, ", aren't hops.
+			continue
+		}
+		addr, err := netip.ParseAddr(host)
+		if err != nil {
+			// Obfuscated or unknown hops end the chain at the last proxy.
+			break
+		}
+		client = addr.Unmap().String()
+		proto = strings.ToLower(strings.TrimSpace(hops[i].proto))
+		if !c.isTrusted(client) {
+			break
+		}
+	}
+	return client, peer, proto
+}
+
+// hop is one proxy hop: the address a proxy received the request from and
+// the proto it was received with, if recorded.
+type hop struct {
+	addr  string
+	proto string
+}
+
+// setForwardedProto pairs X-Forwarded-Proto entries with the hops by
+// position. A single entry, as set by one TLS-terminating proxy, applies to
+// every hop; other mismatched lists are ignored.
+func setForwardedProto(hops []hop, values []string) {
+	var protos []string
+	for _, value := range values {
+		protos = append(protos, strings.Split(value, ",")...)
+	}
+	switch len(protos) {
+	case 1:
+		for i := range hops {
+			hops[i].proto = protos[0]
+		}
+	case len(hops):
+		for i := range hops {
+			hops[i].proto = protos[i]
+		}
+	}
+}
+
+func (c *ClientIPResolver) isTrusted(host string) bool {
+	if c == nil || len(c.trusted) == 0 {
+		return false
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range c.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwarded returns the for= and proto= parameters of the RFC 7239 Forwarded
+// elements that have a for= parameter, in order.
+func forwarded(values []string) []hop {
+	var hops []hop
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			var h hop
+			for _, pair := range strings.Split(element, ";") {
+				key, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if !ok {
+					continue
+				}
+				switch {
+				case strings.EqualFold(key, "for"):
+					h.addr = strings.Trim(val, `"`)
+				case strings.EqualFold(key, "proto"):
+					h.proto = strings.Trim(val, `"`)
+				}
+			}
+			if h.addr != "" {
+				hops = append(hops, h)
+			}
+		}
+	}
+	return hops
+}
+
+// unmap turns an IPv4-mapped IPv6 address into the IPv4 address.
+func unmap(host string) string {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return addr.Unmap().String()
+	}
+	return host
+}
+
+// stripPort removes the port and IPv6 brackets from an address, if present.
+func stripPort(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+}
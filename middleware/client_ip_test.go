@@ -0,0 +1,208 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestClientIPResolverResolve(t *testing.T) {
+	resolver := NewClientIPResolver(
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("fd00::/8"),
+	)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		wantClient string
+		wantPeer   string
+	}{
+		{
+			name:       "untrusted peer ignores headers",
+			remoteAddr: "203.0.113.9:4000",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.1"},
+			wantClient: "203.0.113.9",
+			wantPeer:   "203.0.113.9",
+		},
+		{
+			name:       "trusted peer without headers",
+			remoteAddr: "10.0.0.1:4000",
+			wantClient: "10.0.0.1",
+			wantPeer:   "10.0.0.1",
+		},
+		{
+			name:       "spoofed leftmost hop is skipped",
+			remoteAddr: "10.0.0.1:4000",
+			headers:    map[string]string{"X-Forwarded-For": "1.1.1.1, 198.51.100.7, 10.0.0.2"},
+			wantClient: "198.51.100.7",
+			wantPeer:   "10.0.0.1",
+		},
+		{
+			name:       "all hops trusted yields the leftmost",
+			remoteAddr: "10.0.0.1:4000",
+			headers:    map[string]string{"X-Forwarded-For": "10.0.0.3, 10.0.0.2"},
+			wantClient: "10.0.0.3",
+			wantPeer:   "10.0.0.1",
+		},
+		{
+			name:       "empty hops are skipped",
+			remoteAddr: "10.0.0.1:4000",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.7, , "},
+			wantClient: "198.51.100.7",
+			wantPeer:   "10.0.0.1",
+		},
+		{
+			name:       "invalid hop ends the chain",
+			remoteAddr: "10.0.0.1:4000",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.7, garbage, 10.0.0.2"},
+			wantClient: "10.0.0.2",
+			wantPeer:   "10.0.0.1",
+		},
+		{
+			name:       "forwarded takes precedence",
+			remoteAddr: "10.0.0.1:4000",
+			headers: map[string]string{
+				"Forwarded":       "for=198.51.100.7;proto=https",
+				"X-Forwarded-For": "198.51.100.8",
+			},
+			wantClient: "198.51.100.7",
+			wantPeer:   "10.0.0.1",
+		},
+		{
+			name:       "forwarded spoofed leftmost element",
+			remoteAddr: "10.0.0.1:4000",
+			headers:    map[string]string{"Forwarded": "for=1.1.1.1, for=198.51.100.7, for=10.0.0.2"},
+			wantClient: "198.51.100.7",
+			wantPeer:   "10.0.0.1",
+		},
+		{
+			name:       "forwarded unknown stops at the last proxy",
+			remoteAddr: "10.0.0.1:4000",
+			headers:    map[string]string{"Forwarded": "for=unknown, for=10.0.0.2"},
+			wantClient: "10.0.0.2",
+			wantPeer:   "10.0.0.1",
+		},
+		{
+			name:       "forwarded obfuscated identifier stops at the last proxy",
+			remoteAddr: "10.0.0.1:4000",
+			headers:    map[string]string{"Forwarded": "for=_hidden"},
+			wantClient: "10.0.0.1",
+			wantPeer:   "10.0.0.1",
+		},
+		{
+			name:       "forwarded quoted bracketed IPv6 with port",
+			remoteAddr: "10.0.0.1:4000",
+			headers:    map[string]string{"Forwarded": `for="[2001:db8::7]:4711"`},
+			wantClient: "2001:db8::7",
+			wantPeer:   "10.0.0.1",
+		},
+		{
+			name:       "forwarded element without for is ignored",
+			remoteAddr: "10.0.0.1:4000",
+			headers:    map[string]string{"Forwarded": "for=198.51.100.7, proto=https"},
+			wantClient: "198.51.100.7",
+			wantPeer:   "10.0.0.1",
+		},
+		{
+			name:       "IPv6 peer",
+			remoteAddr: "[fd00::1]:4000",
+			headers:    map[string]string{"X-Forwarded-For": "2001:db8::9"},
+			wantClient: "2001:db8::9",
+			wantPeer:   "fd00::1",
+		},
+		{
+			name:       "IPv4-mapped peer is trusted and unmapped",
+			remoteAddr: "[::ffff:10.0.0.1]:4000",
+			headers:    map[string]string{"X-Forwarded-For": "::ffff:198.51.100.7"},
+			wantClient: "198.51.100.7",
+			wantPeer:   "::ffff:10.0.0.1",
+		},
+		{
+			name:       "IPv4-mapped untrusted peer is unmapped",
+			remoteAddr: "[::ffff:203.0.113.9]:4000",
+			wantClient: "203.0.113.9",
+			wantPeer:   "::ffff:203.0.113.9",
+		},
+		{
+			name:       "X-Real-IP is the last resort",
+			remoteAddr: "10.0.0.1:4000",
+			headers:    map[string]string{"X-Real-IP": "198.51.100.7"},
+			wantClient: "198.51.100.7",
+			wantPeer:   "10.0.0.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for key, value := range tt.headers {
+				r.Header.Set(key, value)
+			}
+
+			client, peer := resolver.Resolve(r)
+			if client != tt.wantClient || peer != tt.wantPeer {
+				t.Errorf("Resolve() = (%q, %q), want (%q, %q)", client, peer, tt.wantClient, tt.wantPeer)
+			}
+		})
+	}
+}
+
+func TestClientIPResolverScheme(t *testing.T) {
+	resolver := NewClientIPResolver(netip.MustParsePrefix("10.0.0.0/8"))
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{
+			name:       "untrusted peer ignores proto",
+			remoteAddr: "203.0.113.9:4000",
+			headers:    map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-For": "198.51.100.7"},
+			want:       "http",
+		},
+		{
+			name:       "single X-Forwarded-Proto applies to every hop",
+			remoteAddr: "10.0.0.1:4000",
+			headers:    map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-For": "198.51.100.7, 10.0.0.2"},
+			want:       "https",
+		},
+		{
+			name:       "X-Forwarded-Proto is paired by position",
+			remoteAddr: "10.0.0.1:4000",
+			headers:    map[string]string{"X-Forwarded-Proto": "https, http", "X-Forwarded-For": "198.51.100.7, 10.0.0.2"},
+			want:       "https",
+		},
+		{
+			name:       "forwarded proto of the client hop",
+			remoteAddr: "10.0.0.1:4000",
+			headers:    map[string]string{"Forwarded": "for=198.51.100.7;proto=HTTPS, for=10.0.0.2;proto=http"},
+			want:       "https",
+		},
+		{
+			name:       "unknown proto falls back to the connection",
+			remoteAddr: "10.0.0.1:4000",
+			headers:    map[string]string{"Forwarded": "for=198.51.100.7;proto=gopher"},
+			want:       "http",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for key, value := range tt.headers {
+				r.Header.Set(key, value)
+			}
+
+			if got := resolver.Scheme(r); got != tt.want {
+				t.Errorf("Scheme() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// durationBuckets are the boundaries recommended by the semantic conventions
+// for http.server.request.duration, in seconds.
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.075, 0.1, 0.25, 0.5, 0.75, 1, 2.5, 5, 7.5, 10}
+
+type serverMetrics struct {
+	duration       metric.Float64Histogram
+	activeRequests metric.Int64UpDownCounter
+	requestSize    metric.Int64Histogram
+	responseSize   metric.Int64Histogram
+}
+
+// newServerMetrics creates the HTTP server instruments. Instruments that fail
+// to be created are reported to the global error handler and replaced by
+// no-ops, so metrics problems never break request handling.
+func newServerMetrics(meter metric.Meter) *serverMetrics {
+	m := &serverMetrics{}
+	var err error
+
+	m.duration, err = meter.Float64Histogram(semconv.HTTPServerRequestDurationName,
+		metric.WithUnit(semconv.HTTPServerRequestDurationUnit),
+		metric.WithDescription(semconv.HTTPServerRequestDurationDescription),
+		metric.WithExplicitBucketBoundaries(durationBuckets...),
+	)
+	handleErr(err)
+
+	m.activeRequests, err = meter.Int64UpDownCounter(semconv.HTTPServerActiveRequestsName,
+		metric.WithUnit(semconv.HTTPServerActiveRequestsUnit),
+		metric.WithDescription(semconv.HTTPServerActiveRequestsDescription),
+	)
+	handleErr(err)
+
+	m.requestSize, err = meter.Int64Histogram(semconv.HTTPServerRequestBodySizeName,
+		metric.WithUnit(semconv.HTTPServerRequestBodySizeUnit),
+		metric.WithDescription(semconv.HTTPServerRequestBodySizeDescription),
+	)
+	handleErr(err)
+
+	m.responseSize, err = meter.Int64Histogram(semconv.HTTPServerResponseBodySizeName,
+		metric.WithUnit(semconv.HTTPServerResponseBodySizeUnit),
+		metric.WithDescription(semconv.HTTPServerResponseBodySizeDescription),
+	)
+	handleErr(err)
+
+	return m
+}
+
+func handleErr(err error) {
+	if err != nil {
+		otel.Handle(err)
+	}
+}
+
+// start marks a request as active and returns the function that ends it.
+// Active requests are keyed by method and scheme only, as the route is not
+// known until the mux has matched the request.
+func (m *serverMetrics) start(ctx context.Context, r *http.Request) func() {
+	set := metric.WithAttributeSet(attribute.NewSet(
+		semconv.HTTPRequestMethodKey.String(httpMethod(r.Method)),
+		semconv.URLScheme(urlScheme(r)),
+	))
+	m.activeRequests.Add(ctx, 1, set)
+	return func() {
+		m.activeRequests.Add(ctx, -1, set)
+	}
+}
+
+// record adds the finished request to the duration and body size histograms.
+// ctx carries the request span, so measurements of sampled requests keep its
+// trace and span IDs as exemplars.
+func (m *serverMetrics) record(ctx context.Context, r *http.Request, status int, elapsed time.Duration, requestSize, responseSize int64) {
+	attrs := []attribute.KeyValue{
+		semconv.HTTPRequestMethodKey.String(httpMethod(r.Method)),
+		semconv.URLScheme(urlScheme(r)),
+		semconv.HTTPResponseStatusCode(status),
+		semconv.NetworkProtocolName("http"),
+		semconv.NetworkProtocolVersion(protocolVersion(r)),
+	}
+	if route := httpRoute(r.Pattern); route != "" {
+		attrs = append(attrs, semconv.HTTPRoute(route))
+	}
+	if status >= http.StatusInternalServerError {
+		attrs = append(attrs, semconv.ErrorTypeKey.String(strconv.Itoa(status)))
+	}
+	set := metric.WithAttributeSet(attribute.NewSet(attrs...))
+
+	m.duration.Record(ctx, elapsed.Seconds(), set)
+	m.requestSize.Record(ctx, requestSize, set)
+	m.responseSize.Record(ctx, responseSize, set)
+}
+
+// httpRoute strips the method and host from a ServeMux pattern such as
+// "GET example.com/items/{id}", leaving "/items/{id}".
+func httpRoute(pattern string) string {
+	if i := strings.IndexByte(pattern, '/'); i >= 0 {
+		return pattern[i:]
+	}
+	return ""
+}
+
+// httpMethod maps methods outside the known set to "_OTHER", as the semantic
+// conventions require, so arbitrary methods cannot inflate cardinality.
+func httpMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "_OTHER"
+}
+
+func urlScheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+func protocolVersion(r *http.Request) string {
+	if r.ProtoMajor >= 2 {
+		return strconv.Itoa(r.ProtoMajor)
+	}
+	return strconv.Itoa(r.ProtoMajor) + "." + strconv.Itoa(r.ProtoMinor)
+}
+
+// countingBody counts the request body bytes read by the handler.
+type countingBody struct {
+	io.ReadCloser
+	n atomic.Int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n.Add(int64(n))
+	return n, err
+}
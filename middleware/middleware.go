@@ -1,51 +1,128 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
+	"time"
+
 	"observability/logs"
+	tracing "observability/tracer"
 
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func TraceMiddleware(serviceName string, logger logs.OtelLogging) func(http.Handler) http.Handler {
+func TraceMiddleware(serviceName string, logger logs.OtelLogging, opts ...Option) func(http.Handler) http.Handler {
 	tracer := otel.Tracer(serviceName)
+	metrics := newServerMetrics(otel.Meter(serviceName))
+	o := newOptions(opts)
 
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := o.excludedPaths[r.URL.Path]; ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			propagator := o.propagator
+			if propagator == nil {
+				propagator = otel.GetTextMapPropagator()
+			}
+			ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+			requestID := RequestIDFromContext(ctx)
+			if requestID == "" {
+				// Without RequestIDMiddleware, the header is checked the same way.
+				if requestID = r.Header.Get(o.requestIDHeader); !validRequestID(requestID) {
+					requestID = NewRequestID()
+				}
+				ctx = ContextWithRequestID(ctx, requestID)
+			}
+			// Extracting inbound baggage replaces what RequestIDMiddleware set.
+			ctx = withRequestIDBaggage(ctx, requestID)
+			if o.forceTrace(r) {
+				ctx = tracing.ForceSampling(ctx)
+			}
 
-			ctx, span := tracer.Start(r.Context(), r.URL.Path)
+			// url.path is set at start so route-based samplers can see it. The
+			// span is renamed once the mux has matched a route.
+			ctx, span := tracer.Start(ctx, r.Method,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					semconv.HTTPRequestMethodKey.String(r.Method),
+					semconv.URLPath(r.URL.Path),
+				),
+			)
 			defer span.End()
 
-			// Wrap ResponseWriter to capture status
-			recorder := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+			start := time.Now()
+			done := metrics.start(ctx, r)
+			defer done()
 
-			next.ServeHTTP(recorder, r.WithContext(ctx))
+			rw := newResponseWriter(w, start)
+			o.setTraceHeaders(w.Header(), span.SpanContext())
+			if o.serverTiming {
+				timing := &serverTiming{}
+				ctx = context.WithValue(ctx, serverTimingKey{}, timing)
+				rw.beforeCommit = func(h http.Header, elapsed time.Duration) {
+					h.Add("Server-Timing", timing.header(elapsed))
+				}
+			}
 
-			meta := logs.RequestMeta{
-				Status:    recorder.statusCode,
-				Path:      r.URL.Path,
-				Domain:    r.URL.Hostname(),
-				Agent:     r.UserAgent(),
-				Method:    r.Method,
-				RemoteIP:  r.RemoteAddr,
-				Query:     r.URL.RawQuery,
-				RequestID: r.Header.Get("X-Request-ID"),
+			// The mux sets Pattern on the request it is given, so keep it to
+			// read the matched route afterwards.
+			req := r.WithContext(ctx)
+			var body *countingBody
+			if req.Body != nil && req.Body != http.NoBody {
+				body = &countingBody{ReadCloser: req.Body}
+				req.Body = body
 			}
-			if meta.Domain == "" {
-				meta.Domain = r.Host
+
+			recovered, stack := serve(next, rw, req, o.recoverPanics)
+			aborted := recovered != nil && isAbort(recovered)
+			if aborted {
+				// Re-panic once the request is recorded, so net/http aborts
+				// the response without logging a stack trace.
+				defer panic(recovered)
+				span.SetStatus(codes.Error, "handler aborted")
+			} else if recovered != nil {
+				client, _ := o.clientIP.Resolve(r)
+				reportPanic(span, logger, rw, req, client, recovered, stack)
+			}
+			if o.serverTiming && !aborted && !rw.headersSent && !rw.hijacked {
+				// net/http would send the implicit 200 without Server-Timing.
+				rw.WriteHeader(http.StatusOK)
 			}
 
+			if route := httpRoute(req.Pattern); route != "" {
+				span.SetAttributes(semconv.HTTPRoute(route))
+			}
+			span.SetName(o.spanNameFormatter(req))
+
+			requestSize := req.ContentLength
+			if body != nil && requestSize < 0 {
+				requestSize = body.n.Load()
+			}
+			status := rw.statusCode()
+			if recovered != nil && !rw.headersSent {
+				status = http.StatusInternalServerError
+			}
+			span.SetAttributes(semconv.HTTPResponseBodySize(int(rw.bytesWritten)))
+			if rw.headersSent {
+				span.AddEvent("http.response.first_byte", trace.WithTimestamp(start.Add(rw.firstByte)))
+			}
+			metrics.record(ctx, req, status, time.Since(start), max(requestSize, 0), rw.bytesWritten)
+
+			client, peer := o.clientIP.Resolve(r)
+			meta := logs.BuildRequestMeta(r, status, start,
+				logs.WithRequestID(requestID),
+				logs.WithAddresses(client, peer),
+				logs.WithScheme(o.clientIP.Scheme(r)),
+				logs.WithSizes(requestSize, rw.bytesWritten),
+			)
 			logger.LogHttpResponse(span, meta)
 		})
 	}
 }
-
-type statusRecorder struct {
-	http.ResponseWriter
-	statusCode int
-}
-
-func (r *statusRecorder) WriteHeader(code int) {
-	r.statusCode = code
-	r.ResponseWriter.WriteHeader(code)
-}
@@ -0,0 +1,157 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/netip"
+
+	"go.opentelemetry.io/otel/propagation"
+)
+
+const DefaultRequestIDHeader = "X-Request-ID"
+
+type Option func(*options)
+
+// SpanNameFormatter names the server span. It runs after the handler, so
+// r.Pattern holds the ServeMux pattern that matched, if any.
+type SpanNameFormatter func(r *http.Request) string
+
+type options struct {
+	requestIDHeader   string
+	excludedPaths     map[string]struct{}
+	forceTraceHeader  string
+	forceTraceToken   string
+	spanNameFormatter SpanNameFormatter
+	propagator        propagation.TextMapPropagator
+	recoverPanics     bool
+	clientIP          *ClientIPResolver
+	traceResponse     bool
+	traceIDHeader     string
+	serverTiming      bool
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		requestIDHeader:   DefaultRequestIDHeader,
+		excludedPaths:     map[string]struct{}{},
+		spanNameFormatter: DefaultSpanNameFormatter,
+		clientIP:          NewClientIPResolver(),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithRequestIDHeader sets the inbound header the request ID is read from.
+func WithRequestIDHeader(header string) Option {
+	return func(o *options) {
+		o.requestIDHeader = header
+	}
+}
+
+// WithExcludedPaths skips tracing and access logging for the given paths,
+// e.g. health checks and /favicon.ico.
+func WithExcludedPaths(paths ...string) Option {
+	return func(o *options) {
+		for _, path := range paths {
+			o.excludedPaths[path] = struct{}{}
+		}
+	}
+}
+
+// WithForceTraceHeader forces sampling of requests whose header, typically
+// tracer.DefaultForceTraceHeader, equals token. The token is a shared secret:
+// without it any client could bypass the sampler and its rate limit, so an
+// empty token disables forcing. The tracer provider's sampler must be wrapped
+// with tracer.NewForceSampler.
+func WithForceTraceHeader(header, token string) Option {
+	return func(o *options) {
+		o.forceTraceHeader = header
+		o.forceTraceToken = token
+	}
+}
+
+// forceTrace reports whether r carries the force trace token.
+func (o *options) forceTrace(r *http.Request) bool {
+	if o.forceTraceHeader == "" || o.forceTraceToken == "" {
+		return false
+	}
+	value := r.Header.Get(o.forceTraceHeader)
+	return subtle.ConstantTimeCompare([]byte(value), []byte(o.forceTraceToken)) == 1
+}
+
+// WithPropagator sets the propagator used to extract the incoming trace
+// context. The default is the global propagator at the time of each request.
+func WithPropagator(propagator propagation.TextMapPropagator) Option {
+	return func(o *options) {
+		o.propagator = propagator
+	}
+}
+
+// WithPanicRecovery recovers panics in the handler: the panic is recorded on
+// the span as an exception event, logged with OtelLogging.Error and answered
+// with a 500 if nothing was written yet. http.ErrAbortHandler is re-panicked
+// so net/http still aborts the connection.
+func WithPanicRecovery() Option {
+	return func(o *options) {
+		o.recoverPanics = true
+	}
+}
+
+// WithTrustedProxies trusts the forwarding headers set by proxies within the
+// given prefixes to find the client address. See ClientIPResolver.
+func WithTrustedProxies(prefixes ...netip.Prefix) Option {
+	return func(o *options) {
+		o.clientIP.trusted = append(o.clientIP.trusted, prefixes...)
+	}
+}
+
+// WithTraceResponse writes the W3C traceresponse header, carrying the trace
+// and server span IDs, so clients can report the trace of a failed request.
+// It is only written when the span is sampled.
+func WithTraceResponse() Option {
+	return func(o *options) {
+		o.traceResponse = true
+	}
+}
+
+// WithTraceIDHeader writes the trace ID to header, typically
+// DefaultTraceIDHeader, for clients that don't parse traceresponse. It is
+// only written when the span is sampled.
+func WithTraceIDHeader(header string) Option {
+	return func(o *options) {
+		o.traceIDHeader = header
+	}
+}
+
+// WithServerTiming writes a Server-Timing header with the time until the
+// headers were written as "total", followed by the phases added with
+// AddServerTiming. Responses the handler left empty are committed with a 200
+// when it returns, so they carry the header too.
+func WithServerTiming() Option {
+	return func(o *options) {
+		o.serverTiming = true
+	}
+}
+
+// WithSpanNameFormatter replaces DefaultSpanNameFormatter.
+func WithSpanNameFormatter(formatter SpanNameFormatter) Option {
+	return func(o *options) {
+		o.spanNameFormatter = formatter
+	}
+}
+
+// DefaultSpanNameFormatter returns "METHOD /route" using the matched pattern,
+// or just the method when no pattern matched, so IDs in paths never end up in
+// span names. Unknown methods are reported as "HTTP".
+func DefaultSpanNameFormatter(r *http.Request) string {
+	method := httpMethod(r.Method)
+	if method == "_OTHER" {
+		method = "HTTP"
+	}
+	if route := httpRoute(r.Pattern); route != "" {
+		return method + " " + route
+	}
+	return method
+}
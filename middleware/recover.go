@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"observability/logs"
+
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// serve calls next, recovering a panic when recoverPanics is set. The stack
+// is captured before unwinding, so it includes the panicking frame.
+func serve(next http.Handler, w http.ResponseWriter, r *http.Request, recoverPanics bool) (recovered any, stack []byte) {
+	if recoverPanics {
+		defer func() {
+			if recovered = recover(); recovered != nil {
+				stack = debug.Stack()
+			}
+		}()
+	}
+	next.ServeHTTP(w, r)
+	return nil, nil
+}
+
+func isAbort(recovered any) bool {
+	err, ok := recovered.(error)
+	return ok && errors.Is(err, http.ErrAbortHandler)
+}
+
+// fieldLogger is implemented by the OtelLogging of the logs package, to log
+// with structured fields.
+type fieldLogger interface {
+	Errorw(span trace.Span, message string, keysAndValues ...interface{})
+}
+
+// reportPanic records a recovered panic on the span and in the logs, and
+// answers with a 500 when the headers have not been sent.
+func reportPanic(span trace.Span, logger logs.OtelLogging, w *responseWriter, r *http.Request, client string, recovered any, stack []byte) {
+	message := fmt.Sprint(recovered)
+	span.AddEvent(semconv.ExceptionEventName, trace.WithAttributes(
+		semconv.ExceptionType(fmt.Sprintf("%T", recovered)),
+		semconv.ExceptionMessage(message),
+		semconv.ExceptionStacktrace(string(stack)),
+	))
+	span.SetStatus(codes.Error, "panic: "+message)
+
+	msg := fmt.Sprintf("panic serving %s %s: %s", r.Method, r.URL.Path, message)
+	if fl, ok := logger.(fieldLogger); ok {
+		fl.Errorw(span, msg,
+			"method", r.Method,
+			"path", r.URL.Path,
+			"client_address", client,
+			"stack", string(stack),
+		)
+	} else {
+		logger.Error(span, msg)
+	}
+
+	if !w.headersSent && !w.hijacked {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
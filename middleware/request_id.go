@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"observability/logs"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/baggage"
+)
+
+// RequestIDBaggageKey is the baggage member carrying the request ID to
+// downstream services.
+const RequestIDBaggageKey = logs.RequestIDBaggageKey
+
+// maxRequestIDLength bounds inbound IDs, which end up in every log record.
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// RequestIDFromContext returns the request ID stored by RequestIDMiddleware.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// ContextWithRequestID returns a copy of ctx carrying requestID.
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// NewRequestID returns a UUID v7, so IDs sort by creation time.
+func NewRequestID() string {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return uuid.NewString()
+	}
+	return id.String()
+}
+
+// RequestIDMiddleware reads the request ID from the request ID header, or
+// generates one with NewRequestID when it is missing or malformed. The ID is
+// echoed in the response header and stored in the context and the baggage.
+// With a logs.RequestIDProcessor registered, as Setup does, records logged
+// through OtelLogging with any span of the request carry the ID.
+func RequestIDMiddleware(opts ...Option) func(http.Handler) http.Handler {
+	o := newOptions(opts)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(o.requestIDHeader)
+			if !validRequestID(id) {
+				id = NewRequestID()
+				r.Header.Set(o.requestIDHeader, id)
+			}
+			w.Header().Set(o.requestIDHeader, id)
+
+			ctx := withRequestIDBaggage(ContextWithRequestID(r.Context(), id), id)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequestIDRoundTripper sets the request ID header on outbound requests whose
+// context carries a request ID and which don't set the header themselves. A
+// nil base uses http.DefaultTransport.
+func RequestIDRoundTripper(base http.RoundTripper, opts ...Option) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &requestIDTransport{base: base, header: newOptions(opts).requestIDHeader}
+}
+
+type requestIDTransport struct {
+	base   http.RoundTripper
+	header string
+}
+
+func (t *requestIDTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	id := RequestIDFromContext(r.Context())
+	if id == "" || r.Header.Get(t.header) != "" {
+		return t.base.RoundTrip(r)
+	}
+	// RoundTrippers must not modify the request they are given.
+	r = r.Clone(r.Context())
+	r.Header.Set(t.header, id)
+	return t.base.RoundTrip(r)
+}
+
+// withRequestIDBaggage adds the request ID to the baggage in ctx. IDs that
+// aren't valid baggage values are left out.
+func withRequestIDBaggage(ctx context.Context, id string) context.Context {
+	member, err := baggage.NewMemberRaw(RequestIDBaggageKey, id)
+	if err != nil {
+		return ctx
+	}
+	bag, err := baggage.FromContext(ctx).SetMember(member)
+	if err != nil {
+		otel.Handle(err)
+		return ctx
+	}
+	return baggage.ContextWithBaggage(ctx, bag)
+}
+
+// validRequestID accepts non-empty IDs of printable ASCII up to
+// maxRequestIDLength bytes, so inbound values can't forge log lines.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// responseWriter records the status, size and timing of a response. It
+// implements http.Flusher, http.Hijacker, io.ReaderFrom and http.Pusher by
+// delegating to the wrapped writer, and Unwrap for http.ResponseController,
+// so streaming, SSE and websocket handlers work behind TraceMiddleware.
+// Methods the wrapped writer lacks return http.ErrNotSupported or do nothing.
+type responseWriter struct {
+	http.ResponseWriter
+	start time.Time
+
+	// status stays 0 until the handler writes headers, so a handler that
+	// panics before writing can be told apart from an implicit 200.
+	status       int
+	bytesWritten int64
+	headersSent  bool
+	firstByte    time.Duration
+	hijacked     bool
+
+	// beforeCommit, if set, runs once just before the headers are written,
+	// so it can still add headers.
+	beforeCommit func(header http.Header, elapsed time.Duration)
+}
+
+func newResponseWriter(w http.ResponseWriter, start time.Time) *responseWriter {
+	return &responseWriter{ResponseWriter: w, start: start}
+}
+
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	// Informational responses other than 101 don't commit the headers.
+	if !w.headersSent && (code >= 200 || code == http.StatusSwitchingProtocols) {
+		w.commit(code)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if !w.headersSent {
+		w.commit(http.StatusOK)
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytesWritten += int64(n)
+	return n, err
+}
+
+func (w *responseWriter) commit(code int) {
+	if w.beforeCommit != nil {
+		w.beforeCommit(w.Header(), time.Since(w.start))
+	}
+	w.status = code
+	w.headersSent = true
+	w.firstByte = time.Since(w.start)
+}
+
+// Flush sends any buffered data, committing the headers with a 200 status if
+// none were written.
+func (w *responseWriter) Flush() {
+	if !w.headersSent {
+		w.commit(http.StatusOK)
+	}
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil {
+		w.hijacked = true
+	}
+	return conn, rw, err
+}
+
+// ReadFrom keeps the sendfile and splice fast paths of the wrapped writer.
+func (w *responseWriter) ReadFrom(r io.Reader) (int64, error) {
+	if !w.headersSent {
+		w.commit(http.StatusOK)
+	}
+	var n int64
+	var err error
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(r)
+	} else {
+		n, err = io.Copy(writerOnly{w.ResponseWriter}, r)
+	}
+	w.bytesWritten += n
+	return n, err
+}
+
+func (w *responseWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := w.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// statusCode returns the status sent to the client once the handler has
+// returned normally: net/http sends 200 if nothing was written. Hijacked
+// connections without a status are assumed to have switched protocols.
+func (w *responseWriter) statusCode() int {
+	switch {
+	case w.status != 0:
+		return w.status
+	case w.hijacked:
+		return http.StatusSwitchingProtocols
+	}
+	return http.StatusOK
+}
+
+// writerOnly hides any ReadFrom method, so io.Copy doesn't recurse into it.
+type writerOnly struct {
+	io.Writer
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultTraceIDHeader is the usual header for WithTraceIDHeader.
+const DefaultTraceIDHeader = "X-Trace-Id"
+
+type serverTimingKey struct{}
+
+// serverTiming collects the Server-Timing entries of a request.
+type serverTiming struct {
+	mu        sync.Mutex
+	entries   []string
+	committed bool
+}
+
+// AddServerTiming adds a phase, such as a database call, to the Server-Timing
+// header of the request in ctx. It does nothing unless the request is served
+// by TraceMiddleware with WithServerTiming, or once the response headers have
+// been written. Characters not allowed in a token are replaced in name.
+func AddServerTiming(ctx context.Context, name string, dur time.Duration) {
+	timing, _ := ctx.Value(serverTimingKey{}).(*serverTiming)
+	if timing == nil {
+		return
+	}
+	timing.mu.Lock()
+	defer timing.mu.Unlock()
+	if timing.committed {
+		return
+	}
+	timing.entries = append(timing.entries, serverTimingEntry(name, dur))
+}
+
+// header returns the Server-Timing value with the total duration first. Later
+// entries are dropped, as the headers are on their way.
+func (t *serverTiming) header(total time.Duration) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.committed = true
+	return strings.Join(append([]string{serverTimingEntry("total", total)}, t.entries...), ", ")
+}
+
+func serverTimingEntry(name string, dur time.Duration) string {
+	return fmt.Sprintf("%s;dur=%.3f", serverTimingName(name), float64(dur)/float64(time.Millisecond))
+}
+
+// serverTimingName makes name a valid HTTP token.
+func serverTimingName(name string) string {
+	if name == "" {
+		return "_"
+	}
+	return strings.Map(func(r rune) rune {
+		if r < 0x80 && (r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' ||
+			strings.ContainsRune("!#$%&'*+-.^_`|~", r)) {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// traceResponse formats the W3C traceresponse header of the server span.
+func traceResponse(sc trace.SpanContext) string {
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID(), sc.SpanID(), sc.TraceFlags())
+}
+
+// setTraceHeaders writes the trace response headers enabled in o, for sampled
+// spans only: an unsampled trace can't be looked up.
+func (o *options) setTraceHeaders(h http.Header, sc trace.SpanContext) {
+	if !sc.IsValid() || !sc.IsSampled() {
+		return
+	}
+	if o.traceResponse {
+		h.Set("traceresponse", traceResponse(sc))
+	}
+	if o.traceIDHeader != "" {
+		h.Set(o.traceIDHeader, sc.TraceID().String())
+	}
+}
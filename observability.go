@@ -0,0 +1,120 @@
+package observability
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"observability/config"
+	"observability/logs"
+	"observability/metrics"
+	"observability/middleware"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const DefaultShutdownTimeout = 10 * time.Second
+
+// Telemetry is the handle returned by Setup. All providers share one resource
+// and are installed as the global providers.
+type Telemetry struct {
+	Logger         logs.OtelLogging
+	TracerProvider trace.TracerProvider
+	MeterProvider  metric.MeterProvider
+	Propagator     propagation.TextMapPropagator
+	// MetricsHandler serves metrics for scraping when the metrics exporter is
+	// prometheus, and is nil otherwise.
+	MetricsHandler http.Handler
+
+	serviceName     string
+	middlewareOpts  []middleware.Option
+	shutdownTimeout time.Duration
+	shutdownFuncs   []func(context.Context) error
+}
+
+// Setup validates cfg and initializes logs, traces and metrics. On error,
+// anything already started is shut down before returning.
+func Setup(ctx context.Context, cfg *config.Config) (*Telemetry, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid observability config: %w", err)
+	}
+
+	t := &Telemetry{
+		serviceName:     cfg.Service.Name,
+		middlewareOpts:  cfg.MiddlewareOptions(),
+		shutdownTimeout: time.Duration(cfg.ShutdownTimeout),
+	}
+	if t.shutdownTimeout == 0 {
+		t.shutdownTimeout = DefaultShutdownTimeout
+	}
+	res := cfg.NewResource()
+	requestIDs := logs.NewRequestIDProcessor()
+
+	lb, err := cfg.LoggerBuilder()
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up logs: %w", err)
+	}
+	logger, logShutdown, err := lb.WithResource(res).WithRequestIDProcessor(requestIDs).BuildWithShutdown(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up logs: %w", err)
+	}
+	t.Logger = logger
+
+	tp, traceShutdown, err := cfg.TracerBuilder().WithResource(res).WithSpanProcessor(requestIDs).Build(ctx)
+	if err != nil {
+		_ = logShutdown(ctx)
+		return nil, fmt.Errorf("failed to set up traces: %w", err)
+	}
+	t.TracerProvider = tp
+	t.Propagator = otel.GetTextMapPropagator()
+
+	mb := cfg.MeterBuilder().WithResource(res)
+	if cfg.Metrics.Exporter.Type == config.ExporterPrometheus {
+		prom := metrics.NewPrometheusExporter()
+		mb.WithPrometheusExporter(prom)
+		t.MetricsHandler = prom
+	}
+	mp, meterShutdown, err := mb.Build(ctx)
+	if err != nil {
+		_ = traceShutdown(ctx)
+		_ = logShutdown(ctx)
+		return nil, fmt.Errorf("failed to set up metrics: %w", err)
+	}
+	t.MeterProvider = mp
+
+	// Spans are flushed first and logs last, so problems flushing the other
+	// signals can still be logged.
+	t.shutdownFuncs = []func(context.Context) error{traceShutdown, meterShutdown, logShutdown}
+	return t, nil
+}
+
+// Middleware wraps next with RequestIDMiddleware and TraceMiddleware using the
+// configured options.
+func (t *Telemetry) Middleware(next http.Handler) http.Handler {
+	opts := append([]middleware.Option{middleware.WithPropagator(t.Propagator)}, t.middlewareOpts...)
+	traced := middleware.TraceMiddleware(t.serviceName, t.Logger, opts...)(next)
+	return middleware.RequestIDMiddleware(opts...)(traced)
+}
+
+// Shutdown flushes and stops every provider in order. When ctx has no
+// deadline, the configured shutdown timeout is applied.
+func (t *Telemetry) Shutdown(ctx context.Context) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.shutdownTimeout)
+		defer cancel()
+	}
+
+	var errs []error
+	for _, shutdown := range t.shutdownFuncs {
+		if err := shutdown(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
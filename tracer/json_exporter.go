@@ -0,0 +1,317 @@
+package tracer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// jsonExporter writes each export batch as one line of OTLP-JSON, the same
+// shape the collector's file exporter produces, so the output can be replayed
+// or inspected with jq.
+type jsonExporter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	closer  io.Closer
+	stopped bool
+}
+
+// NewJSONExporter writes spans as OTLP-JSON lines to w.
+func NewJSONExporter(w io.Writer) sdktrace.SpanExporter {
+	return &jsonExporter{w: w}
+}
+
+// NewFileExporter appends spans as OTLP-JSON lines to the file at path,
+// creating it if needed. The file is closed on Shutdown.
+func NewFileExporter(path string) (sdktrace.SpanExporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open span export file: %w", err)
+	}
+	return &jsonExporter{w: f, closer: f}, nil
+}
+
+func (e *jsonExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	if len(spans) == 0 {
+		return nil
+	}
+	line, err := json.Marshal(toOTLPJSON(spans))
+	if err != nil {
+		return fmt.Errorf("failed to encode spans: %w", err)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.stopped {
+		return nil
+	}
+	_, err = e.w.Write(append(line, '\n'))
+	return err
+}
+
+func (e *jsonExporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.stopped {
+		return nil
+	}
+	e.stopped = true
+	if e.closer != nil {
+		return e.closer.Close()
+	}
+	return nil
+}
+
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	SchemaURL  string           `json:"schemaUrl,omitempty"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope     otlpScope  `json:"scope"`
+	Spans     []otlpSpan `json:"spans"`
+	SchemaURL string     `json:"schemaUrl,omitempty"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID                string         `json:"traceId"`
+	SpanID                 string         `json:"spanId"`
+	TraceState             string         `json:"traceState,omitempty"`
+	ParentSpanID           string         `json:"parentSpanId,omitempty"`
+	Flags                  uint32         `json:"flags"`
+	Name                   string         `json:"name"`
+	Kind                   int            `json:"kind"`
+	StartTimeUnixNano      string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano        string         `json:"endTimeUnixNano"`
+	Attributes             []otlpKeyValue `json:"attributes,omitempty"`
+	DroppedAttributesCount int            `json:"droppedAttributesCount,omitempty"`
+	Events                 []otlpEvent    `json:"events,omitempty"`
+	DroppedEventsCount     int            `json:"droppedEventsCount,omitempty"`
+	Links                  []otlpLink     `json:"links,omitempty"`
+	DroppedLinksCount      int            `json:"droppedLinksCount,omitempty"`
+	Status                 otlpStatus     `json:"status"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano           string         `json:"timeUnixNano"`
+	Name                   string         `json:"name"`
+	Attributes             []otlpKeyValue `json:"attributes,omitempty"`
+	DroppedAttributesCount int            `json:"droppedAttributesCount,omitempty"`
+}
+
+type otlpLink struct {
+	TraceID                string         `json:"traceId"`
+	SpanID                 string         `json:"spanId"`
+	TraceState             string         `json:"traceState,omitempty"`
+	Attributes             []otlpKeyValue `json:"attributes,omitempty"`
+	DroppedAttributesCount int            `json:"droppedAttributesCount,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string         `json:"stringValue,omitempty"`
+	BoolValue   *bool           `json:"boolValue,omitempty"`
+	IntValue    *string         `json:"intValue,omitempty"`
+	DoubleValue *otlpDouble     `json:"doubleValue,omitempty"`
+	ArrayValue  *otlpArrayValue `json:"arrayValue,omitempty"`
+}
+
+type otlpArrayValue struct {
+	Values []otlpAnyValue `json:"values"`
+}
+
+// otlpDouble encodes NaN and the infinities as the strings OTLP-JSON uses,
+// since encoding/json rejects them and would fail the whole batch.
+type otlpDouble float64
+
+func (d otlpDouble) MarshalJSON() ([]byte, error) {
+	f := float64(d)
+	switch {
+	case math.IsNaN(f):
+		return []byte(`"NaN"`), nil
+	case math.IsInf(f, 1):
+		return []byte(`"Infinity"`), nil
+	case math.IsInf(f, -1):
+		return []byte(`"-Infinity"`), nil
+	}
+	return json.Marshal(f)
+}
+
+func toOTLPJSON(spans []sdktrace.ReadOnlySpan) otlpTraces {
+	type scopeKey struct{ name, version, schemaURL string }
+
+	var out otlpTraces
+	resourceIndex := map[attribute.Distinct]int{}
+	scopeIndex := map[attribute.Distinct]map[scopeKey]int{}
+
+	for _, s := range spans {
+		res := s.Resource()
+		resKey := res.Equivalent()
+		ri, ok := resourceIndex[resKey]
+		if !ok {
+			ri = len(out.ResourceSpans)
+			resourceIndex[resKey] = ri
+			scopeIndex[resKey] = map[scopeKey]int{}
+			out.ResourceSpans = append(out.ResourceSpans, otlpResourceSpans{
+				Resource:  otlpResource{Attributes: toOTLPAttributes(res.Attributes())},
+				SchemaURL: res.SchemaURL(),
+			})
+		}
+		rs := &out.ResourceSpans[ri]
+
+		scope := s.InstrumentationScope()
+		sk := scopeKey{scope.Name, scope.Version, scope.SchemaURL}
+		si, ok := scopeIndex[resKey][sk]
+		if !ok {
+			si = len(rs.ScopeSpans)
+			scopeIndex[resKey][sk] = si
+			rs.ScopeSpans = append(rs.ScopeSpans, otlpScopeSpans{
+				Scope:     otlpScope{Name: scope.Name, Version: scope.Version},
+				SchemaURL: scope.SchemaURL,
+			})
+		}
+		rs.ScopeSpans[si].Spans = append(rs.ScopeSpans[si].Spans, toOTLPSpan(s))
+	}
+	return out
+}
+
+func toOTLPSpan(s sdktrace.ReadOnlySpan) otlpSpan {
+	sc := s.SpanContext()
+	span := otlpSpan{
+		TraceID:                sc.TraceID().String(),
+		SpanID:                 sc.SpanID().String(),
+		TraceState:             sc.TraceState().String(),
+		Flags:                  uint32(sc.TraceFlags()),
+		Name:                   s.Name(),
+		Kind:                   int(s.SpanKind()),
+		StartTimeUnixNano:      strconv.FormatInt(s.StartTime().UnixNano(), 10),
+		EndTimeUnixNano:        strconv.FormatInt(s.EndTime().UnixNano(), 10),
+		Attributes:             toOTLPAttributes(s.Attributes()),
+		DroppedAttributesCount: s.DroppedAttributes(),
+		DroppedEventsCount:     s.DroppedEvents(),
+		DroppedLinksCount:      s.DroppedLinks(),
+		Status:                 toOTLPStatus(s.Status()),
+	}
+	if parent := s.Parent(); parent.IsValid() {
+		span.ParentSpanID = parent.SpanID().String()
+	}
+	for _, ev := range s.Events() {
+		span.Events = append(span.Events, otlpEvent{
+			TimeUnixNano:           strconv.FormatInt(ev.Time.UnixNano(), 10),
+			Name:                   ev.Name,
+			Attributes:             toOTLPAttributes(ev.Attributes),
+			DroppedAttributesCount: ev.DroppedAttributeCount,
+		})
+	}
+	for _, link := range s.Links() {
+		span.Links = append(span.Links, otlpLink{
+			TraceID:                link.SpanContext.TraceID().String(),
+			SpanID:                 link.SpanContext.SpanID().String(),
+			TraceState:             link.SpanContext.TraceState().String(),
+			Attributes:             toOTLPAttributes(link.Attributes),
+			DroppedAttributesCount: link.DroppedAttributeCount,
+		})
+	}
+	return span
+}
+
+// toOTLPStatus maps to the OTLP enum, where ERROR is 2 and OK is 1; the Go
+// codes package uses the opposite order.
+func toOTLPStatus(status sdktrace.Status) otlpStatus {
+	out := otlpStatus{Message: status.Description}
+	switch status.Code {
+	case codes.Ok:
+		out.Code = 1
+	case codes.Error:
+		out.Code = 2
+	}
+	return out
+}
+
+func toOTLPAttributes(attrs []attribute.KeyValue) []otlpKeyValue {
+	if len(attrs) == 0 {
+		return nil
+	}
+	out := make([]otlpKeyValue, len(attrs))
+	for i, attr := range attrs {
+		out[i] = otlpKeyValue{Key: string(attr.Key), Value: toOTLPValue(attr.Value)}
+	}
+	return out
+}
+
+func toOTLPValue(v attribute.Value) otlpAnyValue {
+	switch v.Type() {
+	case attribute.BOOL:
+		b := v.AsBool()
+		return otlpAnyValue{BoolValue: &b}
+	case attribute.INT64:
+		i := strconv.FormatInt(v.AsInt64(), 10)
+		return otlpAnyValue{IntValue: &i}
+	case attribute.FLOAT64:
+		f := otlpDouble(v.AsFloat64())
+		return otlpAnyValue{DoubleValue: &f}
+	case attribute.BOOLSLICE:
+		values := v.AsBoolSlice()
+		arr := &otlpArrayValue{Values: make([]otlpAnyValue, len(values))}
+		for i, b := range values {
+			arr.Values[i] = toOTLPValue(attribute.BoolValue(b))
+		}
+		return otlpAnyValue{ArrayValue: arr}
+	case attribute.INT64SLICE:
+		values := v.AsInt64Slice()
+		arr := &otlpArrayValue{Values: make([]otlpAnyValue, len(values))}
+		for i, n := range values {
+			arr.Values[i] = toOTLPValue(attribute.Int64Value(n))
+		}
+		return otlpAnyValue{ArrayValue: arr}
+	case attribute.FLOAT64SLICE:
+		values := v.AsFloat64Slice()
+		arr := &otlpArrayValue{Values: make([]otlpAnyValue, len(values))}
+		for i, f := range values {
+			arr.Values[i] = toOTLPValue(attribute.Float64Value(f))
+		}
+		return otlpAnyValue{ArrayValue: arr}
+	case attribute.STRINGSLICE:
+		values := v.AsStringSlice()
+		arr := &otlpArrayValue{Values: make([]otlpAnyValue, len(values))}
+		for i, str := range values {
+			arr.Values[i] = toOTLPValue(attribute.StringValue(str))
+		}
+		return otlpAnyValue{ArrayValue: arr}
+	default:
+		str := v.Emit()
+		return otlpAnyValue{StringValue: &str}
+	}
+}
@@ -0,0 +1,183 @@
+package tracer
+
+import (
+	"context"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// TruncatedAttributesKey lists the attributes whose values were shortened to
+// the configured AttributeValueLengthLimit. Event attributes are reported as
+// "<event name>:<key>" and link attributes as "link:<key>". It counts against
+// the AttributeCountLimit: a span at the limit drops its last attribute.
+const TruncatedAttributesKey = attribute.Key("otel.span.truncated_attributes")
+
+// truncatingProcessor records which attribute values were cut. The SDK runs
+// with a length limit one character above limit, so values are bounded while
+// the span is recording, and any value longer than limit at OnEnd was
+// truncated by the SDK; the processor cuts the extra character and lists it.
+type truncatingProcessor struct {
+	next       sdktrace.SpanProcessor
+	limit      int
+	countLimit int
+}
+
+func newTruncatingProcessor(next sdktrace.SpanProcessor, limit, countLimit int) sdktrace.SpanProcessor {
+	return &truncatingProcessor{next: next, limit: limit, countLimit: countLimit}
+}
+
+func (p *truncatingProcessor) OnStart(parent context.Context, s sdktrace.ReadWriteSpan) {
+	p.next.OnStart(parent, s)
+}
+
+func (p *truncatingProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	attrs, truncated := p.truncateAll(s.Attributes(), "")
+
+	events := s.Events()
+	var truncatedEvents []sdktrace.Event
+	for i, ev := range events {
+		evAttrs, evTruncated := p.truncateAll(ev.Attributes, ev.Name+":")
+		if len(evTruncated) == 0 {
+			continue
+		}
+		if truncatedEvents == nil {
+			truncatedEvents = append([]sdktrace.Event(nil), events...)
+		}
+		truncatedEvents[i].Attributes = evAttrs
+		truncated = append(truncated, evTruncated...)
+	}
+
+	links := s.Links()
+	var truncatedLinks []sdktrace.Link
+	for i, link := range links {
+		linkAttrs, linkTruncated := p.truncateAll(link.Attributes, "link:")
+		if len(linkTruncated) == 0 {
+			continue
+		}
+		if truncatedLinks == nil {
+			truncatedLinks = append([]sdktrace.Link(nil), links...)
+		}
+		truncatedLinks[i].Attributes = linkAttrs
+		truncated = append(truncated, linkTruncated...)
+	}
+
+	if len(truncated) == 0 {
+		p.next.OnEnd(s)
+		return
+	}
+	if truncatedEvents == nil {
+		truncatedEvents = events
+	}
+	if truncatedLinks == nil {
+		truncatedLinks = links
+	}
+
+	span := truncatedSpan{
+		ReadOnlySpan: s,
+		attrs:        attrs,
+		events:       truncatedEvents,
+		links:        truncatedLinks,
+		dropped:      s.DroppedAttributes(),
+	}
+	if p.countLimit != 0 {
+		if p.countLimit > 0 && len(span.attrs) >= p.countLimit {
+			span.attrs = span.attrs[:p.countLimit-1]
+			span.dropped += len(attrs) - len(span.attrs)
+		}
+		span.attrs = append(span.attrs[:len(span.attrs):len(span.attrs)], TruncatedAttributesKey.StringSlice(truncated))
+	}
+	p.next.OnEnd(span)
+}
+
+func (p *truncatingProcessor) ForceFlush(ctx context.Context) error {
+	return p.next.ForceFlush(ctx)
+}
+
+func (p *truncatingProcessor) Shutdown(ctx context.Context) error {
+	return p.next.Shutdown(ctx)
+}
+
+// truncateAll returns attrs with long values shortened and the keys of the
+// shortened attributes, prefixed with prefix. attrs is only copied when needed.
+func (p *truncatingProcessor) truncateAll(attrs []attribute.KeyValue, prefix string) ([]attribute.KeyValue, []string) {
+	var out []attribute.KeyValue
+	var truncated []string
+	for i, attr := range attrs {
+		value, ok := p.truncate(attr.Value)
+		if !ok {
+			continue
+		}
+		if out == nil {
+			out = append([]attribute.KeyValue(nil), attrs...)
+		}
+		out[i] = attribute.KeyValue{Key: attr.Key, Value: value}
+		truncated = append(truncated, prefix+string(attr.Key))
+	}
+	if out == nil {
+		return attrs, nil
+	}
+	return out, truncated
+}
+
+func (p *truncatingProcessor) truncate(v attribute.Value) (attribute.Value, bool) {
+	switch v.Type() {
+	case attribute.STRING:
+		if s, ok := truncateString(v.AsString(), p.limit); ok {
+			return attribute.StringValue(s), true
+		}
+	case attribute.STRINGSLICE:
+		values := v.AsStringSlice()
+		changed := false
+		for i, s := range values {
+			if short, ok := truncateString(s, p.limit); ok {
+				values[i], changed = short, true
+			}
+		}
+		if changed {
+			return attribute.StringSliceValue(values), true
+		}
+	}
+	return v, false
+}
+
+// truncateString cuts s to at most limit characters, matching how the SDK
+// counts the attribute value length limit.
+func truncateString(s string, limit int) (string, bool) {
+	if utf8.RuneCountInString(s) <= limit {
+		return s, false
+	}
+	count := 0
+	for i := range s {
+		if count == limit {
+			return s[:i], true
+		}
+		count++
+	}
+	return s, false
+}
+
+type truncatedSpan struct {
+	sdktrace.ReadOnlySpan
+	attrs   []attribute.KeyValue
+	events  []sdktrace.Event
+	links   []sdktrace.Link
+	dropped int
+}
+
+func (s truncatedSpan) Attributes() []attribute.KeyValue {
+	return s.attrs
+}
+
+func (s truncatedSpan) Events() []sdktrace.Event {
+	return s.events
+}
+
+func (s truncatedSpan) Links() []sdktrace.Link {
+	return s.links
+}
+
+func (s truncatedSpan) DroppedAttributes() int {
+	return s.dropped
+}
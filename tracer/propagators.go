@@ -0,0 +1,259 @@
+package tracer
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	b3SingleHeader  = "b3"
+	b3TraceIDHeader = "x-b3-traceid"
+	b3SpanIDHeader  = "x-b3-spanid"
+	b3SampledHeader = "x-b3-sampled"
+	b3FlagsHeader   = "x-b3-flags"
+
+	jaegerHeader = "uber-trace-id"
+)
+
+// Propagator names accepted by Propagators, matching the values of OTEL_PROPAGATORS.
+const (
+	PropagatorTraceContext = "tracecontext"
+	PropagatorBaggage      = "baggage"
+	PropagatorB3           = "b3"
+	PropagatorB3Multi      = "b3multi"
+	PropagatorJaeger       = "jaeger"
+	PropagatorNone         = "none"
+)
+
+// B3Propagator propagates Zipkin B3 headers. Extract accepts both the single
+// b3 header and the X-B3-* headers; Inject writes the form selected by
+// SingleHeader.
+type B3Propagator struct {
+	SingleHeader bool
+}
+
+func (p B3Propagator) Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	sampled := "0"
+	if sc.IsSampled() {
+		sampled = "1"
+	}
+	if p.SingleHeader {
+		carrier.Set(b3SingleHeader, sc.TraceID().String()+"-"+sc.SpanID().String()+"-"+sampled)
+		return
+	}
+	carrier.Set(b3TraceIDHeader, sc.TraceID().String())
+	carrier.Set(b3SpanIDHeader, sc.SpanID().String())
+	carrier.Set(b3SampledHeader, sampled)
+}
+
+func (p B3Propagator) Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	var sc trace.SpanContext
+	if single := carrier.Get(b3SingleHeader); single != "" {
+		sc = extractB3Single(single)
+	} else {
+		sc = extractB3Multi(carrier)
+	}
+	if !sc.IsValid() {
+		return ctx
+	}
+	return trace.ContextWithRemoteSpanContext(ctx, sc)
+}
+
+func (p B3Propagator) Fields() []string {
+	if p.SingleHeader {
+		return []string{b3SingleHeader}
+	}
+	return []string{b3TraceIDHeader, b3SpanIDHeader, b3SampledHeader}
+}
+
+// extractB3Single parses {TraceId}-{SpanId}-{SamplingState}-{ParentSpanId},
+// where the last two parts are optional.
+func extractB3Single(value string) trace.SpanContext {
+	parts := strings.Split(value, "-")
+	if len(parts) < 2 || len(parts) > 4 {
+		return trace.SpanContext{}
+	}
+	sampling := ""
+	if len(parts) > 2 {
+		sampling = parts[2]
+	}
+	return newRemoteSpanContext(parts[0], parts[1], sampling == "1" || sampling == "d")
+}
+
+func extractB3Multi(carrier propagation.TextMapCarrier) trace.SpanContext {
+	traceID, spanID := carrier.Get(b3TraceIDHeader), carrier.Get(b3SpanIDHeader)
+	if traceID == "" || spanID == "" {
+		return trace.SpanContext{}
+	}
+	sampled := carrier.Get(b3SampledHeader)
+	debug := carrier.Get(b3FlagsHeader) == "1"
+	return newRemoteSpanContext(traceID, spanID, debug || sampled == "1" || sampled == "true")
+}
+
+// JaegerPropagator propagates the uber-trace-id header in the form
+// {trace-id}:{span-id}:{parent-span-id}:{flags}. Jaeger baggage is not handled.
+type JaegerPropagator struct{}
+
+func (JaegerPropagator) Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	flags := "0"
+	if sc.IsSampled() {
+		flags = "1"
+	}
+	carrier.Set(jaegerHeader, sc.TraceID().String()+":"+sc.SpanID().String()+":0:"+flags)
+}
+
+func (JaegerPropagator) Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	value := carrier.Get(jaegerHeader)
+	if value == "" {
+		return ctx
+	}
+	if unescaped, err := url.QueryUnescape(value); err == nil {
+		value = unescaped
+	}
+	parts := strings.Split(value, ":")
+	if len(parts) != 4 {
+		return ctx
+	}
+	var flags int
+	if _, err := fmt.Sscanf(parts[3], "%x", &flags); err != nil {
+		return ctx
+	}
+	sc := newRemoteSpanContext(parts[0], parts[1], flags&0x1 == 0x1 || flags&0x2 == 0x2)
+	if !sc.IsValid() {
+		return ctx
+	}
+	return trace.ContextWithRemoteSpanContext(ctx, sc)
+}
+
+func (JaegerPropagator) Fields() []string {
+	return []string{jaegerHeader}
+}
+
+// newRemoteSpanContext accepts 64-bit trace IDs, as sent by older B3 and
+// Jaeger clients, by left-padding them to 128 bits.
+func newRemoteSpanContext(traceID, spanID string, sampled bool) trace.SpanContext {
+	if len(traceID) < 32 {
+		traceID = strings.Repeat("0", 32-len(traceID)) + traceID
+	}
+	if len(spanID) < 16 {
+		spanID = strings.Repeat("0", 16-len(spanID)) + spanID
+	}
+	tid, err := trace.TraceIDFromHex(strings.ToLower(traceID))
+	if err != nil {
+		return trace.SpanContext{}
+	}
+	sid, err := trace.SpanIDFromHex(strings.ToLower(spanID))
+	if err != nil {
+		return trace.SpanContext{}
+	}
+	var flags trace.TraceFlags
+	if sampled {
+		flags = trace.FlagsSampled
+	}
+	return trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    tid,
+		SpanID:     sid,
+		TraceFlags: flags,
+		Remote:     true,
+	})
+}
+
+// extractAnyPropagator injects only the configured formats but extracts the
+// span context from any known format, so services still sending B3 or Jaeger
+// headers join the trace regardless of what is configured.
+type extractAnyPropagator struct {
+	configured propagation.TextMapPropagator
+	fallbacks  []propagation.TextMapPropagator
+}
+
+func (p extractAnyPropagator) Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	p.configured.Inject(ctx, carrier)
+}
+
+func (p extractAnyPropagator) Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	ctx = p.configured.Extract(ctx, carrier)
+	for _, fallback := range p.fallbacks {
+		if trace.SpanContextFromContext(ctx).IsValid() {
+			break
+		}
+		ctx = fallback.Extract(ctx, carrier)
+	}
+	return ctx
+}
+
+func (p extractAnyPropagator) Fields() []string {
+	seen := map[string]struct{}{}
+	var fields []string
+	for _, prop := range append([]propagation.TextMapPropagator{p.configured}, p.fallbacks...) {
+		for _, f := range prop.Fields() {
+			if _, ok := seen[f]; !ok {
+				seen[f] = struct{}{}
+				fields = append(fields, f)
+			}
+		}
+	}
+	return fields
+}
+
+// Propagators builds a propagator from OTEL_PROPAGATORS-style names. Inject
+// writes only the named formats; Extract falls back to W3C trace context, B3
+// and Jaeger when the named formats carry no span context. "none" on its own
+// disables propagation.
+func Propagators(names ...string) (propagation.TextMapPropagator, error) {
+	var configured []propagation.TextMapPropagator
+	none := false
+	for _, name := range names {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case PropagatorTraceContext:
+			configured = append(configured, propagation.TraceContext{})
+		case PropagatorBaggage:
+			configured = append(configured, propagation.Baggage{})
+		case PropagatorB3:
+			configured = append(configured, B3Propagator{SingleHeader: true})
+		case PropagatorB3Multi:
+			configured = append(configured, B3Propagator{})
+		case PropagatorJaeger:
+			configured = append(configured, JaegerPropagator{})
+		case PropagatorNone:
+			none = true
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown propagator %q", name)
+		}
+	}
+	if none && len(configured) == 0 {
+		return propagation.NewCompositeTextMapPropagator(), nil
+	}
+
+	return extractAnyPropagator{
+		configured: propagation.NewCompositeTextMapPropagator(configured...),
+		fallbacks: []propagation.TextMapPropagator{
+			propagation.TraceContext{},
+			B3Propagator{},
+			JaegerPropagator{},
+		},
+	}, nil
+}
+
+// PropagatorsFromEnv reads OTEL_PROPAGATORS, defaulting to "tracecontext,baggage".
+func PropagatorsFromEnv() (propagation.TextMapPropagator, error) {
+	value := os.Getenv("OTEL_PROPAGATORS")
+	if value == "" {
+		value = PropagatorTraceContext + "," + PropagatorBaggage
+	}
+	return Propagators(strings.Split(value, ",")...)
+}
@@ -0,0 +1,225 @@
+package tracer
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestB3PropagatorExtract(t *testing.T) {
+	tests := []struct {
+		name        string
+		headers     map[string]string
+		wantTraceID string
+		wantSpanID  string
+		wantSampled bool
+	}{
+		{
+			name: "multi 128-bit",
+			headers: map[string]string{
+				"X-B3-TraceId": "80f198ee56343ba864fe8b2a57d3eff7",
+				"X-B3-SpanId":  "e457b5a2e4d86bd1",
+				"X-B3-Sampled": "1",
+			},
+			wantTraceID: "80f198ee56343ba864fe8b2a57d3eff7",
+			wantSpanID:  "e457b5a2e4d86bd1",
+			wantSampled: true,
+		},
+		{
+			name: "multi 64-bit is left-padded",
+			headers: map[string]string{
+				"X-B3-TraceId": "64fe8b2a57d3eff7",
+				"X-B3-SpanId":  "e457b5a2e4d86bd1",
+				"X-B3-Sampled": "0",
+			},
+			wantTraceID: "000000000000000064fe8b2a57d3eff7",
+			wantSpanID:  "e457b5a2e4d86bd1",
+		},
+		{
+			name: "multi upper-case hex",
+			headers: map[string]string{
+				"X-B3-TraceId": "80F198EE56343BA864FE8B2A57D3EFF7",
+				"X-B3-SpanId":  "E457B5A2E4D86BD1",
+				"X-B3-Sampled": "true",
+			},
+			wantTraceID: "80f198ee56343ba864fe8b2a57d3eff7",
+			wantSpanID:  "e457b5a2e4d86bd1",
+			wantSampled: true,
+		},
+		{
+			name: "multi debug flag samples",
+			headers: map[string]string{
+				"X-B3-TraceId": "80f198ee56343ba864fe8b2a57d3eff7",
+				"X-B3-SpanId":  "e457b5a2e4d86bd1",
+				"X-B3-Flags":   "1",
+			},
+			wantTraceID: "80f198ee56343ba864fe8b2a57d3eff7",
+			wantSpanID:  "e457b5a2e4d86bd1",
+			wantSampled: true,
+		},
+		{
+			name:    "multi without span ID",
+			headers: map[string]string{"X-B3-TraceId": "80f198ee56343ba864fe8b2a57d3eff7"},
+		},
+		{
+			name:        "single 128-bit with parent",
+			headers:     map[string]string{"b3": "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-1-05e3ac9a4f6e3b90"},
+			wantTraceID: "80f198ee56343ba864fe8b2a57d3eff7",
+			wantSpanID:  "e457b5a2e4d86bd1",
+			wantSampled: true,
+		},
+		{
+			name:        "single 64-bit",
+			headers:     map[string]string{"b3": "64fe8b2a57d3eff7-e457b5a2e4d86bd1-d"},
+			wantTraceID: "000000000000000064fe8b2a57d3eff7",
+			wantSpanID:  "e457b5a2e4d86bd1",
+			wantSampled: true,
+		},
+		{
+			name:        "single without sampling state",
+			headers:     map[string]string{"b3": "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1"},
+			wantTraceID: "80f198ee56343ba864fe8b2a57d3eff7",
+			wantSpanID:  "e457b5a2e4d86bd1",
+		},
+		{
+			name: "single takes precedence over multi",
+			headers: map[string]string{
+				"b3":           "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-0",
+				"X-B3-TraceId": "11111111111111111111111111111111",
+				"X-B3-SpanId":  "2222222222222222",
+			},
+			wantTraceID: "80f198ee56343ba864fe8b2a57d3eff7",
+			wantSpanID:  "e457b5a2e4d86bd1",
+		},
+		{
+			name:    "single deny only",
+			headers: map[string]string{"b3": "0"},
+		},
+		{
+			name:    "single too many parts",
+			headers: map[string]string{"b3": "a-b-1-c-d"},
+		},
+		{
+			name:    "invalid hex",
+			headers: map[string]string{"b3": "zzf198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-1"},
+		},
+		{
+			name:    "all-zero trace ID",
+			headers: map[string]string{"b3": "00000000000000000000000000000000-e457b5a2e4d86bd1-1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			carrier := propagation.HeaderCarrier{}
+			for key, value := range tt.headers {
+				carrier.Set(key, value)
+			}
+			sc := trace.SpanContextFromContext(B3Propagator{}.Extract(context.Background(), carrier))
+			assertSpanContext(t, sc, tt.wantTraceID, tt.wantSpanID, tt.wantSampled)
+		})
+	}
+}
+
+func TestJaegerPropagatorExtract(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       string
+		wantTraceID string
+		wantSpanID  string
+		wantSampled bool
+	}{
+		{
+			name:        "128-bit sampled",
+			value:       "80f198ee56343ba864fe8b2a57d3eff7:e457b5a2e4d86bd1:0:1",
+			wantTraceID: "80f198ee56343ba864fe8b2a57d3eff7",
+			wantSpanID:  "e457b5a2e4d86bd1",
+			wantSampled: true,
+		},
+		{
+			name:        "64-bit with short span ID",
+			value:       "64fe8b2a57d3eff7:5b2a:0:0",
+			wantTraceID: "000000000000000064fe8b2a57d3eff7",
+			wantSpanID:  "0000000000005b2a",
+		},
+		{
+			name:        "URL-escaped",
+			value:       "80f198ee56343ba864fe8b2a57d3eff7%3Ae457b5a2e4d86bd1%3A0%3A1",
+			wantTraceID: "80f198ee56343ba864fe8b2a57d3eff7",
+			wantSpanID:  "e457b5a2e4d86bd1",
+			wantSampled: true,
+		},
+		{
+			name:        "debug flag samples",
+			value:       "80f198ee56343ba864fe8b2a57d3eff7:e457b5a2e4d86bd1:0:2",
+			wantTraceID: "80f198ee56343ba864fe8b2a57d3eff7",
+			wantSpanID:  "e457b5a2e4d86bd1",
+			wantSampled: true,
+		},
+		{
+			name:  "missing flags",
+			value: "80f198ee56343ba864fe8b2a57d3eff7:e457b5a2e4d86bd1:0",
+		},
+		{
+			name:  "non-hex flags",
+			value: "80f198ee56343ba864fe8b2a57d3eff7:e457b5a2e4d86bd1:0:x",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			carrier := propagation.HeaderCarrier{}
+			carrier.Set("uber-trace-id", tt.value)
+			sc := trace.SpanContextFromContext(JaegerPropagator{}.Extract(context.Background(), carrier))
+			assertSpanContext(t, sc, tt.wantTraceID, tt.wantSpanID, tt.wantSampled)
+		})
+	}
+}
+
+func TestPropagatorsRoundTrip(t *testing.T) {
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x80, 0xf1, 0x98, 0xee, 0x56, 0x34, 0x3b, 0xa8, 0x64, 0xfe, 0x8b, 0x2a, 0x57, 0xd3, 0xef, 0xf7},
+		SpanID:     trace.SpanID{0xe4, 0x57, 0xb5, 0xa2, 0xe4, 0xd8, 0x6b, 0xd1},
+		TraceFlags: trace.FlagsSampled,
+	})
+
+	for _, name := range []string{PropagatorTraceContext, PropagatorB3, PropagatorB3Multi, PropagatorJaeger} {
+		t.Run(name, func(t *testing.T) {
+			propagator, err := Propagators(name)
+			if err != nil {
+				t.Fatalf("Propagators(%q): %v", name, err)
+			}
+			carrier := propagation.HeaderCarrier{}
+			propagator.Inject(trace.ContextWithSpanContext(context.Background(), sc), carrier)
+			got := trace.SpanContextFromContext(propagator.Extract(context.Background(), carrier))
+			assertSpanContext(t, got, sc.TraceID().String(), sc.SpanID().String(), true)
+		})
+	}
+}
+
+func assertSpanContext(t *testing.T, sc trace.SpanContext, traceID, spanID string, sampled bool) {
+	t.Helper()
+	if traceID == "" {
+		if sc.IsValid() {
+			t.Errorf("extracted %s-%s, want no span context", sc.TraceID(), sc.SpanID())
+		}
+		return
+	}
+	if !sc.IsValid() {
+		t.Fatalf("no span context extracted, want %s-%s", traceID, spanID)
+	}
+	if got := sc.TraceID().String(); got != traceID {
+		t.Errorf("trace ID = %s, want %s", got, traceID)
+	}
+	if got := sc.SpanID().String(); got != spanID {
+		t.Errorf("span ID = %s, want %s", got, spanID)
+	}
+	if sc.IsSampled() != sampled {
+		t.Errorf("sampled = %v, want %v", sc.IsSampled(), sampled)
+	}
+	if !sc.IsRemote() {
+		t.Error("span context is not remote")
+	}
+}
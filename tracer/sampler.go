@@ -0,0 +1,155 @@
+package tracer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const DefaultForceTraceHeader = "X-Force-Trace"
+
+type forceSamplingKey struct{}
+
+// ForceSampling marks ctx so that spans started from it are always sampled
+// by a sampler wrapped with NewForceSampler.
+func ForceSampling(ctx context.Context) context.Context {
+	return context.WithValue(ctx, forceSamplingKey{}, true)
+}
+
+func IsSamplingForced(ctx context.Context) bool {
+	forced, _ := ctx.Value(forceSamplingKey{}).(bool)
+	return forced
+}
+
+// ParentRatioSampler samples new traces with the given probability and
+// follows the parent's decision otherwise.
+func ParentRatioSampler(ratio float64) sdktrace.Sampler {
+	return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))
+}
+
+type forceSampler struct {
+	delegate sdktrace.Sampler
+}
+
+// NewForceSampler samples every span started from a context marked with
+// ForceSampling and defers to delegate for everything else.
+func NewForceSampler(delegate sdktrace.Sampler) sdktrace.Sampler {
+	return forceSampler{delegate: delegate}
+}
+
+func (s forceSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	if p.ParentContext != nil && IsSamplingForced(p.ParentContext) {
+		return sdktrace.SamplingResult{
+			Decision:   sdktrace.RecordAndSample,
+			Tracestate: trace.SpanContextFromContext(p.ParentContext).TraceState(),
+		}
+	}
+	return s.delegate.ShouldSample(p)
+}
+
+func (s forceSampler) Description() string {
+	return fmt.Sprintf("ForceSampler{%s}", s.delegate.Description())
+}
+
+// RouteRule makes a fixed sampling decision for requests whose url.path
+// matches Path exactly, or as a prefix when Path ends in "*".
+type RouteRule struct {
+	Path   string
+	Sample bool
+}
+
+func (r RouteRule) matches(path string) bool {
+	if prefix, ok := strings.CutSuffix(r.Path, "*"); ok {
+		return strings.HasPrefix(path, prefix)
+	}
+	return path == r.Path
+}
+
+type routeSampler struct {
+	rules    []RouteRule
+	fallback sdktrace.Sampler
+}
+
+// NewRouteSampler applies the first matching rule to spans carrying a url.path
+// attribute, such as the server spans started by TraceMiddleware. Spans
+// without a matching rule are passed to fallback.
+func NewRouteSampler(fallback sdktrace.Sampler, rules ...RouteRule) sdktrace.Sampler {
+	return routeSampler{rules: rules, fallback: fallback}
+}
+
+func (s routeSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	for _, attr := range p.Attributes {
+		if attr.Key != semconv.URLPathKey {
+			continue
+		}
+		path := attr.Value.AsString()
+		for _, rule := range s.rules {
+			if !rule.matches(path) {
+				continue
+			}
+			decision := sdktrace.Drop
+			if rule.Sample {
+				decision = sdktrace.RecordAndSample
+			}
+			return sdktrace.SamplingResult{
+				Decision:   decision,
+				Tracestate: trace.SpanContextFromContext(p.ParentContext).TraceState(),
+			}
+		}
+	}
+	return s.fallback.ShouldSample(p)
+}
+
+func (s routeSampler) Description() string {
+	return fmt.Sprintf("RouteSampler{rules=%d,fallback=%s}", len(s.rules), s.fallback.Description())
+}
+
+type rateLimitedSampler struct {
+	delegate  sdktrace.Sampler
+	perSecond float64
+
+	mu      sync.Mutex
+	balance float64
+	last    time.Time
+}
+
+// NewRateLimitedSampler caps the spans sampled by delegate at spansPerSecond,
+// allowing bursts of up to one second's worth (at least one span). Wrap it in sdktrace.ParentBased
+// to limit new traces rather than individual spans.
+func NewRateLimitedSampler(delegate sdktrace.Sampler, spansPerSecond float64) sdktrace.Sampler {
+	return &rateLimitedSampler{
+		delegate:  delegate,
+		perSecond: spansPerSecond,
+		balance:   max(spansPerSecond, 1),
+		last:      time.Now(),
+	}
+}
+
+func (s *rateLimitedSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	result := s.delegate.ShouldSample(p)
+	if result.Decision != sdktrace.RecordAndSample {
+		return result
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.balance = min(max(s.perSecond, 1), s.balance+now.Sub(s.last).Seconds()*s.perSecond)
+	s.last = now
+	if s.balance < 1 {
+		return sdktrace.SamplingResult{Decision: sdktrace.Drop, Tracestate: result.Tracestate}
+	}
+	s.balance--
+	return result
+}
+
+func (s *rateLimitedSampler) Description() string {
+	return fmt.Sprintf("RateLimitedSampler{%g/s,%s}", s.perSecond, s.delegate.Description())
+}
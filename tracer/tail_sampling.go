@@ -0,0 +1,413 @@
+package tracer
+
+import (
+	"container/list"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	DefaultDecisionWait     = 5 * time.Second
+	DefaultRootWait         = time.Minute
+	DefaultMaxTraces        = 10000
+	DefaultMaxSpansPerTrace = 1000
+	DefaultMaxDecisions     = 100000
+)
+
+// TailSamplingPolicy decides whether a complete buffered trace is kept.
+type TailSamplingPolicy interface {
+	Name() string
+	Keep(spans []sdktrace.ReadOnlySpan) bool
+}
+
+type TailSamplingConfig struct {
+	// DecisionWait is how long spans are buffered after the local root span
+	// of a trace ends, for spans ending after it, before the policies are
+	// applied.
+	DecisionWait time.Duration
+	// RootWait bounds how long a trace waits for its local root span, counted
+	// from the first span that ends. It should exceed the slowest request.
+	RootWait time.Duration
+	// MaxTraces bounds the traces buffered at once. When exceeded, the oldest
+	// trace is decided early, preferring traces whose root has ended.
+	MaxTraces int
+	// MaxSpansPerTrace bounds the spans buffered per trace; extra spans are dropped.
+	MaxSpansPerTrace int
+	// MaxDecisions bounds the decisions remembered for spans ending after
+	// their trace was decided. The oldest are forgotten first.
+	MaxDecisions int
+	// Policies are evaluated in order and the first one that keeps the trace
+	// wins. A trace no policy keeps is dropped.
+	Policies []TailSamplingPolicy
+}
+
+type policyFunc struct {
+	name string
+	keep func([]sdktrace.ReadOnlySpan) bool
+}
+
+func (p policyFunc) Name() string                            { return p.name }
+func (p policyFunc) Keep(spans []sdktrace.ReadOnlySpan) bool { return p.keep(spans) }
+
+// ErrorPolicy keeps traces containing any span with an error status.
+func ErrorPolicy() TailSamplingPolicy {
+	return policyFunc{name: "error", keep: func(spans []sdktrace.ReadOnlySpan) bool {
+		for _, s := range spans {
+			if s.Status().Code == codes.Error {
+				return true
+			}
+		}
+		return false
+	}}
+}
+
+// isLocalRoot reports whether s is the first span of its trace in this
+// process.
+func isLocalRoot(s sdktrace.ReadOnlySpan) bool {
+	return !s.Parent().IsValid() || s.Parent().IsRemote()
+}
+
+// LatencyPolicy keeps traces whose local root span took at least threshold.
+// Without a local root, the extent of all buffered spans is used.
+func LatencyPolicy(threshold time.Duration) TailSamplingPolicy {
+	return policyFunc{name: "latency", keep: func(spans []sdktrace.ReadOnlySpan) bool {
+		var start, end time.Time
+		for _, s := range spans {
+			if isLocalRoot(s) {
+				return s.EndTime().Sub(s.StartTime()) >= threshold
+			}
+			if start.IsZero() || s.StartTime().Before(start) {
+				start = s.StartTime()
+			}
+			if s.EndTime().After(end) {
+				end = s.EndTime()
+			}
+		}
+		return end.Sub(start) >= threshold
+	}}
+}
+
+// AttributePolicy keeps traces with a span whose attribute key has one of the
+// given values, or any value when none are given.
+func AttributePolicy(key attribute.Key, values ...string) TailSamplingPolicy {
+	return policyFunc{name: "attribute:" + string(key), keep: func(spans []sdktrace.ReadOnlySpan) bool {
+		for _, s := range spans {
+			for _, attr := range s.Attributes() {
+				if attr.Key != key {
+					continue
+				}
+				if len(values) == 0 {
+					return true
+				}
+				for _, v := range values {
+					if attr.Value.Emit() == v {
+						return true
+					}
+				}
+			}
+		}
+		return false
+	}}
+}
+
+// ProbabilisticPolicy keeps the given fraction of traces, chosen by trace ID
+// so every service makes the same choice. It is meant as the last policy.
+func ProbabilisticPolicy(ratio float64) TailSamplingPolicy {
+	bound := uint64(max(0, min(ratio, 1)) * (1 << 63))
+	return policyFunc{name: "probabilistic", keep: func(spans []sdktrace.ReadOnlySpan) bool {
+		tid := spans[0].SpanContext().TraceID()
+		return binary.BigEndian.Uint64(tid[8:16])>>1 < bound
+	}}
+}
+
+type bufferedTrace struct {
+	id    trace.TraceID
+	spans []sdktrace.ReadOnlySpan
+	// deadline is when the trace is decided: RootWait after its first span
+	// ended, then DecisionWait after its local root ended.
+	deadline time.Time
+	rooted   bool
+	elem     *list.Element
+	// late holds spans that ended while the policies were running, since
+	// spans is read without the lock by then.
+	late []sdktrace.ReadOnlySpan
+}
+
+type tailSamplingProcessor struct {
+	cfg  TailSamplingConfig
+	next sdktrace.SpanProcessor
+
+	mu     sync.Mutex
+	traces map[trace.TraceID]*bufferedTrace
+	// waiting and rooted hold the buffered traces without and with their
+	// local root, each in deadline order.
+	waiting *list.List
+	rooted  *list.List
+	// pending holds traces removed from traces whose decision is being made.
+	pending map[trace.TraceID]*bufferedTrace
+	decided map[trace.TraceID]bool
+	recent  *list.List
+
+	decisions    metric.Int64Counter
+	droppedSpans metric.Int64Counter
+	registration metric.Registration
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// NewTailSamplingProcessor buffers finished spans per trace and exports only
+// the traces kept by cfg.Policies. Use it with a head sampler that samples
+// everything, since unsampled spans never reach the processor.
+//
+// Decisions are counted by the tracer.tail_sampling.decisions metric and
+// spans dropped for exceeding the limits by tracer.tail_sampling.dropped_spans.
+func NewTailSamplingProcessor(exporter sdktrace.SpanExporter, cfg TailSamplingConfig) sdktrace.SpanProcessor {
+	if cfg.DecisionWait <= 0 {
+		cfg.DecisionWait = DefaultDecisionWait
+	}
+	if cfg.MaxTraces <= 0 {
+		cfg.MaxTraces = DefaultMaxTraces
+	}
+	if cfg.RootWait <= 0 {
+		cfg.RootWait = DefaultRootWait
+	}
+	if cfg.MaxSpansPerTrace <= 0 {
+		cfg.MaxSpansPerTrace = DefaultMaxSpansPerTrace
+	}
+	if cfg.MaxDecisions <= 0 {
+		cfg.MaxDecisions = DefaultMaxDecisions
+	}
+
+	p := &tailSamplingProcessor{
+		cfg:     cfg,
+		next:    sdktrace.NewBatchSpanProcessor(exporter),
+		traces:  map[trace.TraceID]*bufferedTrace{},
+		waiting: list.New(),
+		rooted:  list.New(),
+		pending: map[trace.TraceID]*bufferedTrace{},
+		decided: map[trace.TraceID]bool{},
+		recent:  list.New(),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	p.initMetrics()
+
+	go p.run()
+	return p
+}
+
+func (p *tailSamplingProcessor) initMetrics() {
+	meter := otel.Meter("observability/tracer")
+	p.decisions, _ = meter.Int64Counter("tracer.tail_sampling.decisions",
+		metric.WithDescription("Traces decided by the tail sampler, by decision and policy."),
+		metric.WithUnit("{trace}"))
+	p.droppedSpans, _ = meter.Int64Counter("tracer.tail_sampling.dropped_spans",
+		metric.WithDescription("Spans dropped by the tail sampler before a decision, by reason."),
+		metric.WithUnit("{span}"))
+	buffered, _ := meter.Int64ObservableGauge("tracer.tail_sampling.buffered_traces",
+		metric.WithDescription("Traces waiting for a tail sampling decision."),
+		metric.WithUnit("{trace}"))
+	p.registration, _ = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		o.ObserveInt64(buffered, int64(len(p.traces)))
+		return nil
+	}, buffered)
+}
+
+func (p *tailSamplingProcessor) OnStart(parent context.Context, s sdktrace.ReadWriteSpan) {
+	p.next.OnStart(parent, s)
+}
+
+func (p *tailSamplingProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	if !s.SpanContext().IsSampled() {
+		return
+	}
+	id := s.SpanContext().TraceID()
+
+	p.mu.Lock()
+	if keep, ok := p.decided[id]; ok {
+		p.mu.Unlock()
+		// Late spans follow the decision already made for their trace.
+		if keep {
+			p.next.OnEnd(s)
+		}
+		return
+	}
+	if t, ok := p.pending[id]; ok {
+		full := len(t.spans)+len(t.late) >= p.cfg.MaxSpansPerTrace
+		if !full {
+			t.late = append(t.late, s)
+		}
+		p.mu.Unlock()
+		if full {
+			p.droppedSpans.Add(context.Background(), 1, metric.WithAttributes(attribute.String("reason", "trace_too_large")))
+		}
+		return
+	}
+
+	now := time.Now()
+	t, ok := p.traces[id]
+	if !ok {
+		t = &bufferedTrace{id: id, deadline: now.Add(p.cfg.RootWait)}
+		t.elem = p.waiting.PushBack(t)
+		p.traces[id] = t
+	}
+	if !t.rooted && isLocalRoot(s) {
+		// The window for spans ending after the root starts now, so slow
+		// requests are decided with their root.
+		p.waiting.Remove(t.elem)
+		t.rooted = true
+		t.deadline = now.Add(p.cfg.DecisionWait)
+		t.elem = p.rooted.PushBack(t)
+	}
+	if len(t.spans) >= p.cfg.MaxSpansPerTrace {
+		p.mu.Unlock()
+		p.droppedSpans.Add(context.Background(), 1, metric.WithAttributes(attribute.String("reason", "trace_too_large")))
+		return
+	}
+	t.spans = append(t.spans, s)
+	var evicted *bufferedTrace
+	if len(p.traces) > p.cfg.MaxTraces {
+		oldest := p.rooted.Front()
+		if oldest == nil {
+			oldest = p.waiting.Front()
+		}
+		evicted = p.removeLocked(oldest.Value.(*bufferedTrace))
+	}
+	p.mu.Unlock()
+
+	if evicted != nil {
+		p.decide(evicted, "evicted")
+	}
+}
+
+func (p *tailSamplingProcessor) run() {
+	defer close(p.done)
+
+	interval := max(p.cfg.DecisionWait/10, 100*time.Millisecond)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			for _, t := range p.takeExpired(time.Now()) {
+				p.decide(t, "")
+			}
+		}
+	}
+}
+
+// takeExpired removes and returns traces whose deadline is not after now, or
+// all buffered traces when now is zero.
+func (p *tailSamplingProcessor) takeExpired(now time.Time) []*bufferedTrace {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var expired []*bufferedTrace
+	for _, l := range []*list.List{p.rooted, p.waiting} {
+		for e := l.Front(); e != nil; {
+			t := e.Value.(*bufferedTrace)
+			if !now.IsZero() && t.deadline.After(now) {
+				break
+			}
+			e = e.Next()
+			expired = append(expired, p.removeLocked(t))
+		}
+	}
+	return expired
+}
+
+// removeLocked moves t to pending, so spans ending before decide records the
+// decision join t instead of starting a new buffer for the same trace.
+func (p *tailSamplingProcessor) removeLocked(t *bufferedTrace) *bufferedTrace {
+	if t.rooted {
+		p.rooted.Remove(t.elem)
+	} else {
+		p.waiting.Remove(t.elem)
+	}
+	delete(p.traces, t.id)
+	p.pending[t.id] = t
+	return t
+}
+
+func (p *tailSamplingProcessor) decide(t *bufferedTrace, reason string) {
+	keep, policy := false, "none"
+	for _, pol := range p.cfg.Policies {
+		if pol.Keep(t.spans) {
+			keep, policy = true, pol.Name()
+			break
+		}
+	}
+
+	p.mu.Lock()
+	delete(p.pending, t.id)
+	late := t.late
+	p.decided[t.id] = keep
+	p.recent.PushBack(t.id)
+	for p.recent.Len() > p.cfg.MaxDecisions {
+		delete(p.decided, p.recent.Remove(p.recent.Front()).(trace.TraceID))
+	}
+	p.mu.Unlock()
+
+	decision := "dropped"
+	if keep {
+		decision = "sampled"
+		for _, s := range append(t.spans, late...) {
+			p.next.OnEnd(s)
+		}
+	}
+
+	attrs := []attribute.KeyValue{
+		attribute.String("decision", decision),
+		attribute.String("policy", policy),
+	}
+	if reason != "" {
+		attrs = append(attrs, attribute.String("reason", reason))
+	}
+	p.decisions.Add(context.Background(), 1, metric.WithAttributes(attrs...))
+}
+
+func (p *tailSamplingProcessor) flushPending() {
+	for _, t := range p.takeExpired(time.Time{}) {
+		p.decide(t, "flush")
+	}
+}
+
+// ForceFlush decides every buffered trace immediately and flushes the kept spans.
+func (p *tailSamplingProcessor) ForceFlush(ctx context.Context) error {
+	p.flushPending()
+	return p.next.ForceFlush(ctx)
+}
+
+func (p *tailSamplingProcessor) Shutdown(ctx context.Context) error {
+	p.stopOnce.Do(func() { close(p.stop) })
+	<-p.done
+
+	p.flushPending()
+	var errs []error
+	if p.registration != nil {
+		errs = append(errs, p.registration.Unregister())
+	}
+	errs = append(errs, p.next.Shutdown(ctx))
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("failed to shut down tail sampling processor: %w", err)
+	}
+	return nil
+}
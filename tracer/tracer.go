@@ -2,47 +2,315 @@ package tracer
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"observability/auth"
+	"observability/validation"
 
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
 	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/resource"
-	"go.opentelemetry.io/otel/sdk/trace"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
 )
 
-var ELASTIC_APM_SERVICE_NAME = "test-service"
-var ELASTIC_APM_API_KEY = "RUU2ZmE1Z0JCMnI4REdVdi1zVDk6aS1sZlp0RVJhemJ4YU15djc0cmhGQQ=="
-var ELASTIC_APM_ENDPOINT = "https://my-observability-project-b29ff9.apm.us-central1.gcp.elastic.cloud:443"
-
-func InitTracer() func() {
-	ctx := context.Background()
-	exporter, err := otlptracehttp.New(ctx,
-		otlptracehttp.WithEndpointURL(ELASTIC_APM_ENDPOINT),
-		// otlptracehttp.WithInsecure(),
-		otlptracehttp.WithHeaders(map[string]string{
-			"Authorization": "ApiKey " + ELASTIC_APM_API_KEY,
-		}),
-	)
+type Protocol string
+
+const (
+	ProtocolGRPC Protocol = "grpc"
+	ProtocolHTTP Protocol = "http/protobuf"
+)
+
+type Builder struct {
+	serviceName        string
+	endpointUrl        string
+	headers            map[string]string
+	credentials        auth.CredentialProvider
+	protocol           Protocol
+	useConsoleExporter bool
+	exportFile         string
+	resource           *resource.Resource
+	sampler            sdktrace.Sampler
+	spanLimits         *sdktrace.SpanLimits
+	propagators        []propagation.TextMapPropagator
+	tailSampling       *TailSamplingConfig
+	processors         []sdktrace.SpanProcessor
+	errs               validation.Errors
+}
+
+func NewBuilder() *Builder {
+	return &Builder{
+		headers:  map[string]string{},
+		protocol: ProtocolHTTP,
+	}
+}
+
+func (b *Builder) WithServiceName(serviceName string) *Builder {
+	b.serviceName = serviceName
+	return b
+}
+
+func (b *Builder) WithEndpointUrl(endpointUrl string) *Builder {
+	b.endpointUrl = endpointUrl
+	return b
+}
+
+// WithHeaders merges headers into those set by earlier calls. Setting the same
+// header twice with different values is reported by Build.
+func (b *Builder) WithHeaders(headers map[string]string) *Builder {
+	validation.MergeHeaders(&b.errs, "WithHeaders", b.headers, headers)
+	return b
+}
+
+func (b *Builder) WithAuthHeader(token string) *Builder {
+	return b.WithHeaders(map[string]string{
+		"Authorization": "ApiKey " + token,
+	})
+}
+
+func (b *Builder) WithCredentialProvider(provider auth.CredentialProvider) *Builder {
+	b.credentials = provider
+	return b
+}
+
+// WithProtocol selects the OTLP transport. The default is ProtocolHTTP.
+func (b *Builder) WithProtocol(protocol Protocol) *Builder {
+	b.protocol = protocol
+	return b
+}
+
+// WithConsoleExporter writes spans to stdout as OTLP-JSON lines.
+func (b *Builder) WithConsoleExporter() *Builder {
+	b.useConsoleExporter = true
+	return b
+}
+
+// WithFileExporter appends spans to path as OTLP-JSON lines.
+func (b *Builder) WithFileExporter(path string) *Builder {
+	b.exportFile = path
+	return b
+}
+
+// WithResource merges res over the default service resource. Attributes such
+// as deployment.environment come from here.
+func (b *Builder) WithResource(res *resource.Resource) *Builder {
+	b.resource = res
+	return b
+}
+
+func (b *Builder) WithSampler(sampler sdktrace.Sampler) *Builder {
+	b.sampler = sampler
+	return b
+}
+
+// WithSpanLimits bounds attributes, events and links per span. Zero fields
+// keep the SDK default; negative fields mean unlimited. Values longer than
+// AttributeValueLengthLimit are truncated and listed in the
+// otel.span.truncated_attributes attribute of the span.
+func (b *Builder) WithSpanLimits(limits sdktrace.SpanLimits) *Builder {
+	defaults := sdktrace.NewSpanLimits()
+	for _, f := range []struct{ value, fallback *int }{
+		{&limits.AttributeCountLimit, &defaults.AttributeCountLimit},
+		{&limits.AttributeValueLengthLimit, &defaults.AttributeValueLengthLimit},
+		{&limits.EventCountLimit, &defaults.EventCountLimit},
+		{&limits.LinkCountLimit, &defaults.LinkCountLimit},
+		{&limits.AttributePerEventCountLimit, &defaults.AttributePerEventCountLimit},
+		{&limits.AttributePerLinkCountLimit, &defaults.AttributePerLinkCountLimit},
+	} {
+		if *f.value == 0 {
+			*f.value = *f.fallback
+		}
+	}
+	b.spanLimits = &limits
+	return b
+}
+
+// WithSpanProcessor registers p ahead of the exporting processor, so it sees
+// every span before it is exported.
+func (b *Builder) WithSpanProcessor(p sdktrace.SpanProcessor) *Builder {
+	b.processors = append(b.processors, p)
+	return b
+}
+
+// WithTailSampling exports spans through a tail sampling processor instead of
+// exporting every sampled span. Combine it with a head sampler that samples
+// everything.
+func (b *Builder) WithTailSampling(cfg TailSamplingConfig) *Builder {
+	b.tailSampling = &cfg
+	return b
+}
+
+// WithPropagators replaces the default propagators, which are read from
+// OTEL_PROPAGATORS and fall back to TraceContext and Baggage.
+func (b *Builder) WithPropagators(propagators ...propagation.TextMapPropagator) *Builder {
+	b.propagators = append(b.propagators, propagators...)
+	return b
+}
+
+// WithPropagatorNames selects propagators by their OTEL_PROPAGATORS names,
+// e.g. "tracecontext", "baggage", "b3", "b3multi" or "jaeger".
+func (b *Builder) WithPropagatorNames(names ...string) *Builder {
+	propagator, err := Propagators(names...)
 	if err != nil {
-		panic(err)
-	}
-	tp := trace.NewTracerProvider(
-		trace.WithBatcher(exporter),
-		trace.WithResource(resource.NewWithAttributes(
-			semconv.SchemaURL,
-			semconv.ServiceNameKey.String(ELASTIC_APM_SERVICE_NAME),
-			semconv.DeploymentEnvironment("TEST"),
-			semconv.TelemetrySDKLanguageGo,
-		)),
+		b.errs.Addf("WithPropagatorNames", "%v", err)
+		return b
+	}
+	return b.WithPropagators(propagator)
+}
+
+// Build creates the tracer provider and installs it, together with the
+// propagators, as the global provider. The returned shutdown flushes any
+// buffered spans.
+func (b *Builder) Build(ctx context.Context) (trace.TracerProvider, func(context.Context) error, error) {
+	if err := b.validate(); err != nil {
+		return nil, nil, fmt.Errorf("invalid tracer configuration: %w", err)
+	}
+
+	res, err := b.newResource(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create resource: %w", err)
+	}
+
+	exporter, err := b.newExporter(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sampler := b.sampler
+	if sampler == nil {
+		sampler = sdktrace.ParentBased(sdktrace.AlwaysSample())
+	}
+
+	var processor sdktrace.SpanProcessor
+	if b.tailSampling != nil {
+		processor = NewTailSamplingProcessor(exporter, *b.tailSampling)
+	} else {
+		processor = sdktrace.NewBatchSpanProcessor(exporter)
+	}
+
+	var limits *sdktrace.SpanLimits
+	if b.spanLimits != nil {
+		l := *b.spanLimits
+		if l.AttributeValueLengthLimit >= 0 {
+			processor = newTruncatingProcessor(processor, l.AttributeValueLengthLimit, l.AttributeCountLimit)
+			// The SDK keeps one extra character, so values stay bounded in
+			// memory and the processor can tell which ones were cut.
+			l.AttributeValueLengthLimit++
+		}
+		limits = &l
+	}
+
+	var providerOpts []sdktrace.TracerProviderOption
+	for _, p := range b.processors {
+		providerOpts = append(providerOpts, sdktrace.WithSpanProcessor(p))
+	}
+	providerOpts = append(providerOpts,
+		sdktrace.WithSpanProcessor(processor),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sampler),
 	)
+	if limits != nil {
+		providerOpts = append(providerOpts, sdktrace.WithRawSpanLimits(*limits))
+	}
+	tp := sdktrace.NewTracerProvider(providerOpts...)
+
+	propagators := b.propagators
+	if len(propagators) == 0 {
+		propagator, _ := PropagatorsFromEnv()
+		propagators = []propagation.TextMapPropagator{propagator}
+	}
 	otel.SetTracerProvider(tp)
-	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
-		propagation.TraceContext{},
-		propagation.Baggage{},
-	))
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagators...))
+
+	return tp, tp.Shutdown, nil
+}
+
+func (b *Builder) newResource(ctx context.Context) (*resource.Resource, error) {
+	res, err := resource.New(ctx,
+		resource.WithAttributes(
+			semconv.ServiceName(b.serviceName),
+			semconv.TelemetrySDKLanguageGo,
+		),
+	)
+	if err != nil || b.resource == nil {
+		return res, err
+	}
+	return resource.Merge(res, b.resource)
+}
 
-	return func() {
-		_ = tp.Shutdown(ctx)
+func (b *Builder) newExporter(ctx context.Context) (sdktrace.SpanExporter, error) {
+	if b.useConsoleExporter {
+		return NewJSONExporter(os.Stdout), nil
+	}
+	if b.exportFile != "" {
+		return NewFileExporter(b.exportFile)
+	}
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch b.protocol {
+	case ProtocolGRPC:
+		var opts []otlptracegrpc.Option
+		if b.endpointUrl != "" {
+			opts = append(opts, otlptracegrpc.WithEndpointURL(b.endpointUrl))
+		}
+		if len(b.headers) > 0 {
+			opts = append(opts, otlptracegrpc.WithHeaders(b.headers))
+		}
+		if b.credentials != nil {
+			opts = append(opts, otlptracegrpc.WithDialOption(grpc.WithPerRPCCredentials(auth.PerRPCCredentials(b.credentials, b.endpointUrl))))
+		}
+		exporter, err = otlptracegrpc.New(ctx, opts...)
+	default:
+		var opts []otlptracehttp.Option
+		if b.endpointUrl != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(b.endpointUrl))
+		}
+		if len(b.headers) > 0 {
+			opts = append(opts, otlptracehttp.WithHeaders(b.headers))
+		}
+		if b.credentials != nil {
+			opts = append(opts, otlptracehttp.WithHTTPClient(&http.Client{
+				Transport: auth.RoundTripper(b.credentials, nil),
+			}))
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP span exporter for %q: %w", b.endpointUrl, err)
+	}
+	return exporter, nil
+}
+
+func (b *Builder) validate() error {
+	errs := append(validation.Errors(nil), b.errs...)
+
+	validation.ValidateExporter(&errs, validation.Exporter{
+		ServiceName: b.serviceName,
+		Endpoint:    b.endpointUrl,
+		Headers:     b.headers,
+		Credentials: b.credentials != nil,
+		Console:     b.useConsoleExporter,
+		File:        b.exportFile != "",
+	})
+	switch b.protocol {
+	case ProtocolGRPC, ProtocolHTTP:
+	default:
+		errs.Addf("WithProtocol", "unknown protocol %q, expected %q or %q", b.protocol, ProtocolGRPC, ProtocolHTTP)
+	}
+	if len(b.propagators) == 0 {
+		if _, err := PropagatorsFromEnv(); err != nil {
+			errs.Addf("OTEL_PROPAGATORS", "%v", err)
+		}
+	}
+	if b.tailSampling != nil && len(b.tailSampling.Policies) == 0 {
+		errs.Addf("WithTailSampling", "at least one policy is required, otherwise every trace is dropped")
 	}
+	return errs.Err()
 }
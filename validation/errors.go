@@ -0,0 +1,139 @@
+package validation
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// FieldError describes a single invalid setting. Field is the option or
+// config key that caused it, e.g. "traces.exporter.endpoint".
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	if e.Field == "" {
+		return e.Message
+	}
+	return e.Field + ": " + e.Message
+}
+
+// Errors aggregates every FieldError found while validating a configuration.
+type Errors []*FieldError
+
+func (e *Errors) Addf(field, format string, args ...interface{}) {
+	*e = append(*e, &FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (e Errors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	lines := make([]string, 0, len(e))
+	for _, fe := range e {
+		lines = append(lines, "  - "+fe.Error())
+	}
+	return fmt.Sprintf("%d validation errors:\n%s", len(e), strings.Join(lines, "\n"))
+}
+
+func (e Errors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, fe := range e {
+		errs[i] = fe
+	}
+	return errs
+}
+
+// Err returns nil when no errors were recorded so callers can return it directly.
+func (e Errors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// ValidateEndpoint checks that raw is an absolute http(s) URL with a host.
+func ValidateEndpoint(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid URL %q: %w", raw, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("URL %q must use http or https scheme", raw)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("URL %q has no host", raw)
+	}
+	return nil
+}
+
+// MergeHeaders copies src into dst, recording an error against option for
+// empty names and for names already set to a different value. Names are
+// stored lower-cased, as gRPC metadata requires, so a header set twice with
+// different case is sent once; HTTP exporters canonicalize them again.
+func MergeHeaders(errs *Errors, option string, dst, src map[string]string) {
+	for key, value := range src {
+		if key == "" {
+			errs.Addf(option, "header name must not be empty")
+			continue
+		}
+		name := strings.ToLower(key)
+		if prev, ok := dst[name]; ok && prev != value {
+			errs.Addf(option, "header %q is set more than once with different values", key)
+		}
+		dst[name] = value
+	}
+}
+
+// Exporter holds the exporter settings every signal builder validates the
+// same way. Console and File report whether those local exporters are set.
+type Exporter struct {
+	ServiceName string
+	Endpoint    string
+	Headers     map[string]string
+	Credentials bool
+	Console     bool
+	File        bool
+}
+
+// ValidateExporter records in errs the problems with e, named after the
+// builder options that set them.
+func ValidateExporter(errs *Errors, e Exporter) {
+	if strings.TrimSpace(e.ServiceName) == "" {
+		errs.Addf("WithServiceName", "service name is required")
+	}
+	if e.Endpoint != "" {
+		if err := ValidateEndpoint(e.Endpoint); err != nil {
+			errs.Addf("WithEndpointUrl", "%v", err)
+		}
+	}
+	for _, local := range []struct {
+		option string
+		set    bool
+	}{
+		{"WithConsoleExporter", e.Console},
+		{"WithFileExporter", e.File},
+	} {
+		if !local.set {
+			continue
+		}
+		if e.Endpoint != "" {
+			errs.Addf(local.option, "cannot be combined with WithEndpointUrl")
+		}
+		if len(e.Headers) > 0 || e.Credentials {
+			errs.Addf(local.option, "cannot be combined with headers or credentials")
+		}
+	}
+	if e.Console && e.File {
+		errs.Addf("WithFileExporter", "cannot be combined with WithConsoleExporter")
+	}
+	if e.Credentials {
+		for key := range e.Headers {
+			if strings.EqualFold(key, "Authorization") {
+				errs.Addf("WithCredentialProvider", "conflicts with the Authorization header set by WithHeaders or WithAuthHeader")
+			}
+		}
+	}
+}